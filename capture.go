@@ -0,0 +1,256 @@
+package diag
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/netlink"
+)
+
+// captureVersion is the version of the capture format written by Record.
+const captureVersion = 1
+
+// ErrReplay is returned, if a request does not match the capture that is
+// replayed.
+var ErrReplay = errors.New("request does not match capture")
+
+// captureHeader is the first line of a capture.
+type captureHeader struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	ByteOrder string `json:"byte_order"`
+}
+
+// captureEntry is a single operation of a capture. Every entry is a line
+// of JSON.
+type captureEntry struct {
+	// Op is either send or receive.
+	Op       string            `json:"op"`
+	Messages []netlink.Message `json:"messages,omitempty"`
+	// NetNS is the inode of the network namespace of the connection,
+	// if it was opened by ForEachNetNS.
+	NetNS uint64 `json:"netns,omitempty"`
+
+	// Errno, Message and Offset describe an error of the kernel.
+	Errno   syscall.Errno `json:"errno,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Offset  int           `json:"offset,omitempty"`
+	// Error holds any other error.
+	Error string `json:"error,omitempty"`
+}
+
+func byteOrder() string {
+	if nativeEndian.Uint16([]byte{1, 0}) == 1 {
+		return "little"
+	}
+	return "big"
+}
+
+// captureWriter writes the header and entries of a capture. It is shared
+// by all connections that record to the same writer.
+type captureWriter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	header bool
+}
+
+func newCaptureWriter(w io.Writer) *captureWriter {
+	return &captureWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *captureWriter) write(entry captureEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.header {
+		if err := w.enc.Encode(captureHeader{
+			Format:    "go-diag",
+			Version:   captureVersion,
+			ByteOrder: byteOrder(),
+		}); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	return w.enc.Encode(entry)
+}
+
+// recorder is a diagConn, that writes all messages to w.
+type recorder struct {
+	diagConn
+
+	w     *captureWriter
+	netns uint64
+}
+
+func newRecorder(con diagConn, w *captureWriter, netns uint64) *recorder {
+	return &recorder{diagConn: con, w: w, netns: netns}
+}
+
+func (r *recorder) record(op string, msgs []netlink.Message, err error) error {
+	entry := captureEntry{Op: op, Messages: msgs, NetNS: r.netns}
+	var opErr *netlink.OpError
+	switch {
+	case err == nil:
+	case errors.As(err, &opErr) && errors.As(opErr.Err, &entry.Errno):
+		entry.Message = opErr.Message
+		entry.Offset = opErr.Offset
+	default:
+		entry.Error = err.Error()
+	}
+	return r.w.write(entry)
+}
+
+func (r *recorder) Send(m netlink.Message) (netlink.Message, error) {
+	verify, err := r.diagConn.Send(m)
+	if err != nil {
+		return verify, err
+	}
+	return verify, r.record("send", []netlink.Message{verify}, nil)
+}
+
+func (r *recorder) Receive() ([]netlink.Message, error) {
+	msgs, err := r.diagConn.Receive()
+	if recErr := r.record("receive", msgs, err); recErr != nil && err == nil {
+		err = recErr
+	}
+	return msgs, err
+}
+
+func (r *recorder) Execute(m netlink.Message) ([]netlink.Message, error) {
+	if err := r.record("send", []netlink.Message{m}, nil); err != nil {
+		return nil, err
+	}
+	msgs, err := r.diagConn.Execute(m)
+	if recErr := r.record("receive", msgs, err); recErr != nil && err == nil {
+		err = recErr
+	}
+	return msgs, err
+}
+
+// replayer is a diagConn, that answers requests from a capture.
+type replayer struct {
+	mu      sync.Mutex
+	scanner *bufio.Scanner
+}
+
+// OpenReplay returns a Diag that answers its requests with the messages
+// of a capture written with Config.Record. Requests must be made in the
+// same order as during the recording, otherwise ErrReplay is returned.
+// A capture of ForEachNetNS, NetDumpAll or UnixDumpAll holds the requests
+// of all namespaces, which are replayed in order by the returned Diag.
+// The options ExtendedAcknowledge, StrictCheck and NetNS of config are
+// ignored.
+func OpenReplay(r io.Reader, config *Config) (*Diag, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	scanner := bufio.NewScanner(r)
+	// Dumps of busy hosts are large.
+	scanner.Buffer(nil, 1<<30)
+
+	var header captureHeader
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("read capture header: %w", errors.Join(scanner.Err(), io.ErrUnexpectedEOF))
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+	if header.Format != "go-diag" || header.Version != captureVersion {
+		return nil, fmt.Errorf("unsupported capture format %q version %d",
+			header.Format, header.Version)
+	}
+	if header.ByteOrder != byteOrder() {
+		return nil, fmt.Errorf("capture of %s endian host can not be replayed on %s endian host",
+			header.ByteOrder, byteOrder())
+	}
+	return newDiag(&replayer{scanner: scanner}, config), nil
+}
+
+func (r *replayer) next(op string) (captureEntry, error) {
+	var entry captureEntry
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return entry, err
+		}
+		return entry, fmt.Errorf("%w: end of capture", ErrReplay)
+	}
+	if err := json.Unmarshal(r.scanner.Bytes(), &entry); err != nil {
+		return entry, err
+	}
+	if entry.Op != op {
+		return entry, fmt.Errorf("%w: %s instead of %s", ErrReplay, op, entry.Op)
+	}
+	return entry, nil
+}
+
+func (r *replayer) Send(m netlink.Message) (netlink.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.send(m)
+}
+
+func (r *replayer) send(m netlink.Message) (netlink.Message, error) {
+	entry, err := r.next("send")
+	if err != nil {
+		return netlink.Message{}, err
+	}
+	if len(entry.Messages) != 1 {
+		return netlink.Message{}, fmt.Errorf("%w: invalid send", ErrReplay)
+	}
+	recorded := entry.Messages[0]
+	if recorded.Header.Type != m.Header.Type || string(recorded.Data) != string(m.Data) {
+		return netlink.Message{}, fmt.Errorf("%w: request differs", ErrReplay)
+	}
+	return recorded, nil
+}
+
+func (r *replayer) Receive() ([]netlink.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.receive()
+}
+
+func (r *replayer) receive() ([]netlink.Message, error) {
+	entry, err := r.next("receive")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case entry.Errno != 0:
+		return nil, &netlink.OpError{
+			Op:      "receive",
+			Err:     entry.Errno,
+			Message: entry.Message,
+			Offset:  entry.Offset,
+		}
+	case entry.Error != "":
+		return nil, errors.New(entry.Error)
+	}
+	return entry.Messages, nil
+}
+
+func (r *replayer) Execute(m netlink.Message) ([]netlink.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.send(m); err != nil {
+		return nil, err
+	}
+	return r.receive()
+}
+
+func (r *replayer) Close() error { return nil }
+
+func (r *replayer) JoinGroup(group uint32) error { return ErrNotSupported }
+
+func (r *replayer) LeaveGroup(group uint32) error { return ErrNotSupported }
+
+func (r *replayer) SetOption(option netlink.ConnOption, enable bool) error { return nil }
+
+func (r *replayer) SetReadDeadline(t time.Time) error { return nil }
@@ -0,0 +1,151 @@
+package diag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nltest"
+)
+
+func TestRecordReplay(t *testing.T) {
+	reply := buildNetMessage(t, DiagMsg{Family: unix.AF_INET, INode: 42}, func(ae *netlink.AttributeEncoder) {
+		ae.String(inetDiagCong, "cubic")
+	})
+	calls := 0
+	con := nltest.Dial(func(reqs []netlink.Message) ([]netlink.Message, error) {
+		calls++
+		if calls > 1 {
+			req := reqs[0]
+			req.Header.Flags = netlink.Request
+			return nltest.Error(int(syscall.ENOENT), []netlink.Message{req})
+		}
+		msg := reply
+		msg.Header.Type = unix.SOCK_DIAG_BY_FAMILY
+		msg.Header.Sequence = reqs[0].Header.Sequence
+		return []netlink.Message{msg}, nil
+	})
+
+	var capture bytes.Buffer
+	d, err := OpenConn(con, &Config{Record: &capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &NetOption{Family: unix.AF_INET, Protocol: unix.IPPROTO_TCP, State: AllStates}
+	recorded, err := d.NetDump(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.NetDump(opt); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	d.Close()
+
+	d, err = OpenReplay(bytes.NewReader(capture.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := d.NetDump(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 1 || replayed[0].INode != recorded[0].INode ||
+		*replayed[0].Cong != *recorded[0].Cong {
+		t.Fatalf("expected %+v, got %+v", recorded, replayed)
+	}
+	if _, err := d.NetDump(opt); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	if _, err := d.NetDump(opt); !errors.Is(err, ErrReplay) {
+		t.Fatalf("expected %v at the end of the capture, got %v", ErrReplay, err)
+	}
+
+	d, err = OpenReplay(bytes.NewReader(capture.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.NetDump(&NetOption{Family: unix.AF_INET6}); !errors.Is(err, ErrReplay) {
+		t.Fatalf("expected %v for different request, got %v", ErrReplay, err)
+	}
+
+	if _, err := OpenReplay(bytes.NewReader([]byte("{}\n")), nil); err == nil {
+		t.Fatalf("expected error for invalid capture")
+	}
+}
+
+func TestRecordReplayNetDumpAll(t *testing.T) {
+	dir := t.TempDir()
+	var namespaces []NetNS
+	for _, ns := range []NetNS{{Inode: 1, Name: "blue"}, {Inode: 2, Name: "red"}} {
+		ns.Path = filepath.Join(dir, ns.Name)
+		if err := os.WriteFile(ns.Path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		namespaces = append(namespaces, ns)
+	}
+
+	open := openNetNS
+	defer func() { openNetNS = open }()
+	var ino uint32
+	openNetNS = func(config *Config) (*Diag, error) {
+		// Every namespace holds a single socket with its own inode.
+		ino++
+		reply := buildNetMessage(t, DiagMsg{Family: unix.AF_INET, INode: ino},
+			func(ae *netlink.AttributeEncoder) {})
+		con := nltest.Dial(func(reqs []netlink.Message) ([]netlink.Message, error) {
+			msg := reply
+			msg.Header.Type = unix.SOCK_DIAG_BY_FAMILY
+			msg.Header.Sequence = reqs[0].Header.Sequence
+			return []netlink.Message{msg}, nil
+		})
+		return OpenConn(con, config)
+	}
+
+	var capture bytes.Buffer
+	opt := &NetOption{Family: unix.AF_INET, Protocol: unix.IPPROTO_TCP, State: AllStates}
+	recorded, err := NetDumpAll(namespaces, &Config{Record: &capture}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 sockets, got %d", len(recorded))
+	}
+
+	lines := strings.Split(strings.TrimSpace(capture.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected header and 4 entries, got %d lines", len(lines))
+	}
+	for i, line := range lines[1:] {
+		var entry captureEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if expected := namespaces[i/2].Inode; entry.NetNS != expected {
+			t.Errorf("entry %d: expected netns %d, got %d", i, expected, entry.NetNS)
+		}
+	}
+
+	d, err := OpenReplay(bytes.NewReader(capture.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range recorded {
+		replayed, err := d.NetDump(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(replayed) != 1 || replayed[0].INode != obj.INode {
+			t.Fatalf("expected socket %d of %s, got %+v", obj.INode, obj.NetNS.Name, replayed)
+		}
+	}
+	if _, err := d.NetDump(opt); !errors.Is(err, ErrReplay) {
+		t.Fatalf("expected %v at the end of the capture, got %v", ErrReplay, err)
+	}
+}
@@ -0,0 +1,166 @@
+package diag
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// CGroup describes a cgroup v2 as referenced by NetAttribute.CGroupID.
+type CGroup struct {
+	// Path of the cgroup relative to the root of the cgroup2 mount.
+	Path string `json:"path"`
+	// Runtime is the container runtime that created the cgroup, like
+	// docker, containerd or crio, if it could be identified.
+	Runtime string `json:"runtime,omitempty"`
+	// ContainerID is the ID of the container, if any.
+	ContainerID string `json:"container_id,omitempty"`
+	// PodUID is the UID of the Kubernetes pod, if any.
+	PodUID string `json:"pod_uid,omitempty"`
+}
+
+var (
+	containerIDPattern = regexp.MustCompile(`(?:^|/)(?:(docker|cri-containerd|crio|libpod)-)?([0-9a-f]{64})(?:\.scope)?$`)
+	podUIDPattern      = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// ParseCGroupPath returns the CGroup for path and extracts the container
+// ID and pod UID for common container runtimes.
+func ParseCGroupPath(path string) CGroup {
+	cg := CGroup{Path: path}
+	if m := containerIDPattern.FindStringSubmatch(path); m != nil {
+		cg.ContainerID = m[2]
+		switch m[1] {
+		case "cri-containerd":
+			cg.Runtime = "containerd"
+		case "libpod":
+			cg.Runtime = "podman"
+		case "":
+			if strings.Contains(path, "/docker/") {
+				cg.Runtime = "docker"
+			}
+		default:
+			cg.Runtime = m[1]
+		}
+	}
+	if m := podUIDPattern.FindStringSubmatch(path); m != nil {
+		cg.PodUID = strings.ReplaceAll(m[1], "_", "-")
+	}
+	return cg
+}
+
+// CGroupResolver maps cgroup IDs to cgroup v2 paths.
+type CGroupResolver struct {
+	root string
+
+	mu    sync.RWMutex
+	index map[uint64]CGroup
+}
+
+// NewCGroupResolver returns a CGroupResolver for the cgroup2 mount of
+// the current mount namespace. Call Refresh to populate it.
+func NewCGroupResolver() (*CGroupResolver, error) {
+	root, err := cgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	return newCGroupResolver(root), nil
+}
+
+func newCGroupResolver(root string) *CGroupResolver {
+	return &CGroupResolver{
+		root:  root,
+		index: make(map[uint64]CGroup),
+	}
+}
+
+// cgroup2Mount returns the mount point of cgroup2.
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if mnt := parseCGroup2Mount(f); mnt != "" {
+		return mnt, nil
+	}
+	return "", ErrNotFound
+}
+
+func parseCGroup2Mount(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Format: ID parentID major:minor root mountpoint options [optional fields] - fstype source superoptions
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field != "-" {
+				continue
+			}
+			if i+1 < len(fields) && fields[i+1] == "cgroup2" && len(fields) > 4 {
+				return fields[4]
+			}
+			break
+		}
+	}
+	return ""
+}
+
+// Refresh walks the cgroup2 hierarchy and rebuilds the index.
+func (r *CGroupResolver) Refresh() error {
+	index := make(map[uint64]CGroup)
+	err := filepath.WalkDir(r.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// cgroups can be removed while walking the hierarchy.
+			if path != r.root {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		ino, err := fileInode(path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return err
+		}
+		index[ino] = ParseCGroupPath(filepath.Clean("/" + rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.index = index
+	r.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the cgroup for the given cgroup ID.
+func (r *CGroupResolver) Lookup(id uint64) (CGroup, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cg, ok := r.index[id]
+	return cg, ok
+}
+
+// ResolveNet sets CGroup of every element of objs that reports a CGroupID.
+func (r *CGroupResolver) ResolveNet(objs []NetObject) {
+	for i := range objs {
+		if objs[i].CGroupID == nil {
+			continue
+		}
+		if cg, ok := r.Lookup(*objs[i].CGroupID); ok {
+			objs[i].CGroup = &cg
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package diag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCGroupResolver(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "system.slice", "nginx.service")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ino, err := fileInode(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newCGroupResolver(root)
+	if err := r.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	objs := []NetObject{{NetAttribute: NetAttribute{CGroupID: &ino}}, {}}
+	r.ResolveNet(objs)
+	if objs[0].CGroup == nil || objs[0].CGroup.Path != "/system.slice/nginx.service" {
+		t.Fatalf("unexpected cgroup %v", objs[0].CGroup)
+	}
+	if objs[1].CGroup != nil {
+		t.Fatalf("expected no cgroup without CGroupID")
+	}
+}
@@ -0,0 +1,46 @@
+package diag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCGroupPath(t *testing.T) {
+	id := strings.Repeat("ab12", 16)
+	tests := map[string]CGroup{
+		"/system.slice/nginx.service": {},
+		"/system.slice/docker-" + id + ".scope": {
+			Runtime:     "docker",
+			ContainerID: id,
+		},
+		"/docker/" + id: {
+			Runtime:     "docker",
+			ContainerID: id,
+		},
+		"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_4e5f_6a7b_8c9d_0e1f2a3b4c5d.slice/cri-containerd-" + id + ".scope": {
+			Runtime:     "containerd",
+			ContainerID: id,
+			PodUID:      "0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d",
+		},
+		"/kubepods/burstable/pod0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d/" + id: {
+			ContainerID: id,
+			PodUID:      "0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d",
+		},
+	}
+
+	for path, expected := range tests {
+		expected.Path = path
+		if got := ParseCGroupPath(path); got != expected {
+			t.Errorf("ParseCGroupPath(%q): expected %+v, got %+v", path, expected, got)
+		}
+	}
+}
+
+func TestParseCGroup2Mount(t *testing.T) {
+	mountinfo := `22 27 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+30 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw,nsdelegate
+`
+	if got := parseCGroup2Mount(strings.NewReader(mountinfo)); got != "/sys/fs/cgroup" {
+		t.Fatalf("expected /sys/fs/cgroup, got %q", got)
+	}
+}
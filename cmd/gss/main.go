@@ -0,0 +1,275 @@
+// Command gss is a socket statistics tool similar to ss from iproute2.
+//
+// Usage:
+//
+//	gss [options] [FILTER]
+//
+// Single letter options can be combined, like in gss -tlnp. FILTER uses
+// the syntax of ss, see diag.ParseFilter.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/florianl/go-diag"
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+type options struct {
+	tcp, udp, unix, raw bool
+	ipv4, ipv6          bool
+	listening, all      bool
+	numeric             bool
+	extended            bool
+	memory              bool
+	info                bool
+	timers              bool
+	processes           bool
+	kill                bool
+	json                bool
+
+	// record and replay are files of captured netlink traffic.
+	record, replay string
+
+	states uint32
+	filter *diag.Filter
+}
+
+func main() {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gss: %v\n", err)
+		os.Exit(2)
+	}
+	if err := run(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "gss: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// shortFlags are the single letter options that can be combined.
+const shortFlags = "tuxwlaneimopK46"
+
+// expandArgs splits combined single letter options like -tlnp.
+func expandArgs(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' &&
+			strings.Trim(arg[1:], shortFlags) == "" {
+			for _, c := range arg[1:] {
+				out = append(out, "-"+string(c))
+			}
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+func parseArgs(args []string) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("gss", flag.ContinueOnError)
+	boolFlag := func(p *bool, short, long, usage string) {
+		fs.BoolVar(p, short, false, usage)
+		fs.BoolVar(p, long, false, usage)
+	}
+	boolFlag(&opts.tcp, "t", "tcp", "display TCP sockets")
+	boolFlag(&opts.udp, "u", "udp", "display UDP sockets")
+	boolFlag(&opts.unix, "x", "unix", "display Unix domain sockets")
+	boolFlag(&opts.raw, "w", "raw", "display RAW sockets")
+	boolFlag(&opts.listening, "l", "listening", "display listening sockets")
+	boolFlag(&opts.all, "a", "all", "display all sockets")
+	boolFlag(&opts.numeric, "n", "numeric", "don't resolve service names")
+	boolFlag(&opts.extended, "e", "extended", "show detailed socket information")
+	boolFlag(&opts.memory, "m", "memory", "show socket memory usage")
+	boolFlag(&opts.info, "i", "info", "show internal TCP information")
+	boolFlag(&opts.timers, "o", "options", "show timer information")
+	boolFlag(&opts.processes, "p", "processes", "show process using socket")
+	boolFlag(&opts.kill, "K", "kill", "forcibly close sockets, display what was closed")
+	boolFlag(&opts.ipv4, "4", "ipv4", "display only IP version 4 sockets")
+	boolFlag(&opts.ipv6, "6", "ipv6", "display only IP version 6 sockets")
+	fs.BoolVar(&opts.json, "json", false, "format output in JSON")
+	fs.StringVar(&opts.record, "record", "", "write the netlink traffic to `file`")
+	fs.StringVar(&opts.replay, "replay", "", "read the netlink traffic from `file` instead of the kernel")
+
+	if err := fs.Parse(expandArgs(args)); err != nil {
+		return nil, err
+	}
+
+	if !opts.tcp && !opts.udp && !opts.unix && !opts.raw {
+		opts.tcp, opts.udp, opts.raw = true, true, true
+		// Restricting the IP version excludes Unix sockets, unless
+		// they were asked for explicitly.
+		opts.unix = !opts.ipv4 && !opts.ipv6
+	}
+
+	if fs.NArg() != 0 {
+		filter, err := diag.ParseFilter(strings.Join(fs.Args(), " "))
+		if err != nil {
+			return nil, err
+		}
+		opts.filter = filter
+		// Except for states, the predicates refer to IP sockets and
+		// can not match Unix sockets.
+		if !filter.StatesOnly() {
+			opts.unix = false
+		}
+	}
+	switch {
+	case opts.filter != nil && hasStates(opts.filter):
+		// The filter selects the states.
+		opts.states = diag.AllStates
+	case opts.all:
+		opts.states = diag.AllStates
+	case opts.listening:
+		opts.states = diag.StateMask(diag.StateListen, diag.StateClose)
+	default:
+		opts.states = stateConnected
+	}
+	return opts, nil
+}
+
+// stateConnected is the default state filter of ss.
+var stateConnected = diag.AllStates &^ diag.StateMask(diag.StateListen, diag.StateClose,
+	diag.StateTimeWait, diag.StateSynRecv)
+
+func hasStates(filter *diag.Filter) bool {
+	_, ok := filter.States()
+	return ok
+}
+
+func openDiag(opts *options, record io.Writer) (*diag.Diag, error) {
+	config := &diag.Config{Lenient: true}
+	if opts.replay != "" {
+		data, err := os.ReadFile(opts.replay)
+		if err != nil {
+			return nil, err
+		}
+		return diag.OpenReplay(bytes.NewReader(data), config)
+	}
+	config.Record = record
+	nl, err := diag.Open(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not open netlink socket: %w", err)
+	}
+	return nl, nil
+}
+
+func run(opts *options) (err error) {
+	var record io.Writer
+	if opts.record != "" && opts.replay == "" {
+		f, err := os.Create(opts.record)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		record = f
+	}
+
+	nl, err := openDiag(opts, record)
+	if err != nil {
+		return err
+	}
+	defer nl.Close()
+
+	var procs *diag.ProcResolver
+	if opts.processes {
+		procs = diag.NewProcResolver()
+		if err := procs.Refresh(); err != nil {
+			return err
+		}
+	}
+
+	var families []uint8
+	if opts.ipv4 || !opts.ipv6 {
+		families = append(families, unix.AF_INET)
+	}
+	if opts.ipv6 || !opts.ipv4 {
+		families = append(families, unix.AF_INET6)
+	}
+
+	var ext uint8
+	if opts.memory {
+		ext |= diag.ExtSkMemInfo
+	}
+	if opts.info {
+		ext |= diag.ExtInfo | diag.ExtCong | diag.ExtVegasInfo
+	}
+
+	var rows []row
+	for _, proto := range []struct {
+		enabled  bool
+		netid    string
+		protocol uint8
+	}{
+		{opts.tcp, "tcp", unix.IPPROTO_TCP},
+		{opts.udp, "udp", unix.IPPROTO_UDP},
+		{opts.raw, "raw", unix.IPPROTO_RAW},
+	} {
+		if !proto.enabled {
+			continue
+		}
+		for _, family := range families {
+			opt := &diag.NetOption{
+				Family:      family,
+				Protocol:    proto.protocol,
+				Ext:         ext,
+				State:       opts.states,
+				RawProtocol: unix.IPPROTO_RAW,
+				Filter:      opts.filter,
+			}
+			objs, err := nl.NetDump(opt)
+			if err != nil {
+				return fmt.Errorf("could not dump %s sockets: %w", proto.netid, err)
+			}
+			if procs != nil {
+				procs.ResolveNet(objs)
+			}
+			for _, obj := range objs {
+				if opts.kill {
+					opt.ID = obj.ID
+					if err := nl.NetDestroy(opt); err != nil {
+						fmt.Fprintf(os.Stderr, "gss: could not close socket %v: %v\n",
+							obj.ID.Local(obj.Family), err)
+						continue
+					}
+				}
+				rows = append(rows, netRow(opts, proto.netid, obj))
+			}
+		}
+	}
+
+	if opts.unix && !opts.kill {
+		states := opts.states
+		if opts.filter != nil && hasStates(opts.filter) {
+			states, _ = opts.filter.States()
+		}
+		objs, err := nl.UnixDump(&diag.UnixOption{
+			State: states,
+			Show:  diag.ShowName | diag.ShowPeer | diag.ShowRQLen | diag.ShowUID | diag.ShowMemInfo,
+		})
+		if err != nil {
+			return fmt.Errorf("could not dump unix sockets: %w", err)
+		}
+		if procs != nil {
+			procs.ResolveUnix(objs)
+		}
+		for _, obj := range objs {
+			rows = append(rows, unixRow(opts, obj))
+		}
+	}
+
+	if opts.json {
+		return writeJSON(os.Stdout, rows)
+	}
+	return writeTable(os.Stdout, opts, rows)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/florianl/go-diag"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-tlnp", "-4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.tcp || !opts.listening || !opts.numeric || !opts.processes || !opts.ipv4 {
+		t.Fatalf("combined flags not parsed: %+v", opts)
+	}
+	if opts.udp || opts.unix || opts.raw {
+		t.Fatalf("unexpected protocol selected: %+v", opts)
+	}
+	if expected := diag.StateMask(diag.StateListen, diag.StateClose); opts.states != expected {
+		t.Fatalf("expected states 0x%x, got 0x%x", expected, opts.states)
+	}
+
+	opts, err = parseArgs([]string{"-4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.tcp || !opts.udp || !opts.raw || opts.unix {
+		t.Fatalf("expected all IP protocols without unix: %+v", opts)
+	}
+}
+
+func TestParseArgsFilter(t *testing.T) {
+	opts, err := parseArgs([]string{"-t", "state", "established", "dport", "=", ":443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.filter == nil || opts.states != diag.AllStates {
+		t.Fatalf("expected filter to select states: %+v", opts)
+	}
+	states, _ := opts.filter.States()
+	if states != diag.StateMask(diag.StateEstablished) {
+		t.Fatalf("unexpected states 0x%x", states)
+	}
+
+	opts, err = parseArgs([]string{"dport", "=", ":443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.tcp || opts.unix {
+		t.Fatalf("expected port filter to exclude unix sockets: %+v", opts)
+	}
+	opts, err = parseArgs([]string{"state", "listening"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.unix {
+		t.Fatalf("expected state filter to keep unix sockets: %+v", opts)
+	}
+
+	if _, err := parseArgs([]string{"state", "foo"}); err == nil {
+		t.Fatalf("expected error for unknown state")
+	}
+}
+
+func TestFormatTimer(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		0:                                     "0ms",
+		250 * time.Millisecond:                "250ms",
+		90 * time.Second:                      "1min30sec",
+		7200*time.Second + 5*time.Millisecond: "120min5ms",
+	} {
+		if got := formatTimer(d); got != expected {
+			t.Errorf("formatTimer(%v): expected %q, got %q", d, expected, got)
+		}
+	}
+}
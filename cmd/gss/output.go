@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/florianl/go-diag"
+	"github.com/florianl/go-diag/internal/services"
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// row is a single socket in the output.
+type row struct {
+	netid string
+	state string
+	recvQ uint32
+	sendQ uint32
+	local string
+	peer  string
+	procs []diag.Process
+
+	// info holds the text representation of extended information.
+	info []string
+	// details holds the text representation shown in a separate line.
+	details []string
+
+	// obj is the socket for the JSON output.
+	obj interface{}
+}
+
+func netRow(opts *options, netid string, obj diag.NetObject) row {
+	r := row{
+		netid: netid,
+		state: obj.SockState().String(),
+		recvQ: obj.RQueue,
+		sendQ: obj.WQueue,
+		local: formatAddr(opts, netid, obj.ID.Local(obj.Family), obj.ID.If),
+		peer:  formatAddr(opts, netid, obj.ID.Remote(obj.Family), 0),
+		procs: obj.Processes,
+		obj:   obj,
+	}
+
+	if opts.timers && obj.TimerKind() != diag.TimerOff {
+		r.info = append(r.info, fmt.Sprintf("timer:(%s,%s,%d)", obj.TimerKind(),
+			formatTimer(obj.ExpiresDuration()), obj.Retrans))
+	}
+	if opts.extended {
+		r.info = append(r.info, fmt.Sprintf("uid:%d ino:%d sk:%x", obj.UID, obj.INode,
+			obj.ID.CookieValue()))
+	}
+	if opts.memory && obj.SkMemInfo != nil {
+		r.details = append(r.details, formatSkMem(obj.SkMemInfo))
+	}
+	if opts.info && obj.TcpInfo != nil {
+		r.details = append(r.details, formatTcpInfo(obj.Cong, obj.TcpInfo))
+	}
+	return r
+}
+
+func unixRow(opts *options, obj diag.UnixObject) row {
+	r := row{
+		netid: unixNetid(obj.Type),
+		state: obj.SockState().String(),
+		local: "*",
+		peer:  "*",
+		procs: obj.Processes,
+		obj:   obj,
+	}
+	if obj.Name != nil && *obj.Name != "" {
+		r.local = strings.Replace(*obj.Name, "\x00", "@", 1)
+	}
+	r.local += " " + strconv.FormatUint(uint64(obj.Ino), 10)
+	if obj.Peer != nil {
+		r.peer += " " + strconv.FormatUint(uint64(*obj.Peer), 10)
+	} else {
+		r.peer += " 0"
+	}
+	if obj.RQLen != nil {
+		r.recvQ = obj.RQLen.RQueue
+		r.sendQ = obj.RQLen.WQueue
+	}
+	if opts.extended && obj.UID != nil {
+		r.info = append(r.info, fmt.Sprintf("uid:%d ino:%d", *obj.UID, obj.Ino))
+	}
+	return r
+}
+
+func unixNetid(sockType uint8) string {
+	switch sockType {
+	case unix.SOCK_STREAM:
+		return "u_str"
+	case unix.SOCK_DGRAM:
+		return "u_dgr"
+	case unix.SOCK_SEQPACKET:
+		return "u_seq"
+	}
+	return "u_" + strconv.Itoa(int(sockType))
+}
+
+func formatAddr(opts *options, netid string, ap netip.AddrPort, ifIndex uint32) string {
+	host := "*"
+	if ap.Addr().IsValid() {
+		host = ap.Addr().String()
+		if ap.Addr().Is6() {
+			host = "[" + host + "]"
+		}
+	}
+	if ifIndex != 0 {
+		if iface, err := net.InterfaceByIndex(int(ifIndex)); err == nil {
+			host += "%" + iface.Name
+		}
+	}
+	port := "*"
+	if ap.Port() != 0 {
+		port = strconv.Itoa(int(ap.Port()))
+		if !opts.numeric {
+			if name, ok := services.Default().Name(ap.Port(), netid); ok {
+				port = name
+			}
+		}
+	}
+	return host + ":" + port
+}
+
+// formatTimer formats d like ss, e.g. 1min30sec.
+func formatTimer(d time.Duration) string {
+	ms := d.Milliseconds()
+	mins := ms / 60000
+	secs := (ms / 1000) % 60
+	ms %= 1000
+	var out string
+	if mins != 0 {
+		out += fmt.Sprintf("%dmin", mins)
+	}
+	if secs != 0 {
+		out += fmt.Sprintf("%dsec", secs)
+	}
+	if ms != 0 || out == "" {
+		out += fmt.Sprintf("%dms", ms)
+	}
+	return out
+}
+
+func formatSkMem(m *diag.SkMemInfo) string {
+	return fmt.Sprintf("skmem:(r%d,rb%d,t%d,tb%d,f%d,w%d,o%d,bl%d,d%d)",
+		m.RMemAlloc, m.RcvBuff, m.WMemAlloc, m.SndBuff, m.FwdAlloc,
+		m.WMemQueued, m.OptMem, m.Backlog, m.Drops)
+}
+
+func formatMs(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
+
+func formatTcpInfo(cong *string, info *diag.TcpInfo) string {
+	var out []string
+	if info.HasTimestamps() {
+		out = append(out, "ts")
+	}
+	if info.HasSACK() {
+		out = append(out, "sack")
+	}
+	if info.HasECN() {
+		out = append(out, "ecn")
+	}
+	if info.ECNSeen() {
+		out = append(out, "ecnseen")
+	}
+	if cong != nil {
+		out = append(out, *cong)
+	}
+	if info.HasWscale() {
+		out = append(out, fmt.Sprintf("wscale:%d,%d", info.SndWscale(), info.RcvWscale()))
+	}
+	out = append(out,
+		"rto:"+formatMs(info.RtoDuration()),
+		fmt.Sprintf("rtt:%s/%s", formatMs(info.RttDuration()), formatMs(info.RttvarDuration())),
+		fmt.Sprintf("mss:%d", info.SndMss),
+		fmt.Sprintf("cwnd:%d", info.SndCwnd),
+	)
+	if info.BytesAcked != 0 {
+		out = append(out, fmt.Sprintf("bytes_acked:%d", info.BytesAcked))
+	}
+	if info.BytesReceived != 0 {
+		out = append(out, fmt.Sprintf("bytes_received:%d", info.BytesReceived))
+	}
+	out = append(out,
+		fmt.Sprintf("segs_out:%d", info.SegsOut),
+		fmt.Sprintf("segs_in:%d", info.SegsIn),
+		fmt.Sprintf("lastsnd:%d", info.LastDataSent),
+		fmt.Sprintf("lastrcv:%d", info.LastDataRecv),
+		fmt.Sprintf("lastack:%d", info.LastAckRecv),
+	)
+	if info.PacingRate != 0 && info.PacingRate != ^uint64(0) {
+		out = append(out, "pacing_rate "+formatBps(info.PacingRateBps()))
+	}
+	if info.DeliveryRate != 0 {
+		out = append(out, "delivery_rate "+formatBps(info.DeliveryRateBps()))
+	}
+	if info.Retrans != 0 || info.RotalRetrans != 0 {
+		out = append(out, fmt.Sprintf("retrans:%d/%d", info.Retrans, info.RotalRetrans))
+	}
+	if info.MinRtt != 0 {
+		out = append(out, "minrtt:"+formatMs(info.MinRttDuration()))
+	}
+	return strings.Join(out, " ")
+}
+
+func formatBps(bps uint64) string {
+	switch {
+	case bps >= 1000000000:
+		return strconv.FormatFloat(float64(bps)/1e9, 'f', 1, 64) + "Gbps"
+	case bps >= 1000000:
+		return strconv.FormatFloat(float64(bps)/1e6, 'f', 1, 64) + "Mbps"
+	case bps >= 1000:
+		return strconv.FormatFloat(float64(bps)/1e3, 'f', 1, 64) + "Kbps"
+	}
+	return strconv.FormatUint(bps, 10) + "bps"
+}
+
+func formatProcesses(procs []diag.Process) string {
+	users := make([]string, 0, len(procs))
+	for _, p := range procs {
+		users = append(users, fmt.Sprintf("(%q,pid=%d,fd=%d)", p.Comm, p.PID, p.FD))
+	}
+	return "users:(" + strings.Join(users, ",") + ")"
+}
+
+func writeJSON(w io.Writer, rows []row) error {
+	objs := make([]interface{}, 0, len(rows))
+	for _, r := range rows {
+		objs = append(objs, r.obj)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(objs)
+}
+
+func writeTable(w io.Writer, opts *options, rows []row) error {
+	header := []string{"Netid", "State", "Recv-Q", "Send-Q", "Local Address:Port", "Peer Address:Port"}
+	lines := [][]string{header}
+	for _, r := range rows {
+		lines = append(lines, []string{
+			r.netid,
+			r.state,
+			strconv.FormatUint(uint64(r.recvQ), 10),
+			strconv.FormatUint(uint64(r.sendQ), 10),
+			r.local,
+			r.peer,
+		})
+	}
+
+	widths := make([]int, len(header))
+	for _, line := range lines {
+		for i, cell := range line {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, line := range lines {
+		for j, cell := range line {
+			if j > 0 {
+				bw.WriteString(" ")
+			}
+			if j == len(line)-1 {
+				bw.WriteString(cell)
+				continue
+			}
+			fmt.Fprintf(bw, "%-*s", widths[j], cell)
+		}
+		if i > 0 {
+			r := rows[i-1]
+			if opts.processes && len(r.procs) > 0 {
+				bw.WriteString(" " + formatProcesses(r.procs))
+			}
+			for _, info := range r.info {
+				bw.WriteString(" " + info)
+			}
+			for _, details := range r.details {
+				bw.WriteString("\n\t " + details)
+			}
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
@@ -2,7 +2,9 @@ package diag
 
 import (
 	"fmt"
+	"math"
 	"net/netip"
+	"time"
 	"unsafe"
 
 	"github.com/florianl/go-diag/internal/unix"
@@ -28,6 +30,9 @@ func uint64Ptr(v uint64) *uint64 {
 //
 // For the special case 0.0.0.0 or :: it can return an unspecified address.
 // For details, see [netip.IsUnspecified].
+//
+// ToNetipAddr always returns an IPv6 address. Use ToNetipAddrWithFamily or
+// (SockID).Local and (SockID).Remote to get IPv4 addresses right.
 func ToNetipAddr(in [4]uint32) netip.Addr {
 	limiter := 16 // 4 * sizeof(uint32)
 	s := unsafe.Slice((*byte)(unsafe.Pointer(&in[0])), limiter)
@@ -53,9 +58,218 @@ func ToNetipAddrWithFamily(family uint8, in [4]uint32) (netip.Addr, error) {
 	return ip, nil
 }
 
+// FromNetipAddr converts ip to its [4]uint32 representation.
+// It is the reverse of ToNetipAddrWithFamily.
+func FromNetipAddr(ip netip.Addr) [4]uint32 {
+	var out [4]uint32
+	s := unsafe.Slice((*byte)(unsafe.Pointer(&out[0])), 16)
+	if ip.Is4() {
+		b := ip.As4()
+		copy(s, b[:])
+	} else if ip.Is6() {
+		b := ip.As16()
+		copy(s, b[:])
+	}
+	return out
+}
+
+func toAddrPort(family uint8, ip [4]uint32, port uint16) netip.AddrPort {
+	addr, err := ToNetipAddrWithFamily(family, ip)
+	if err != nil {
+		return netip.AddrPort{}
+	}
+	return netip.AddrPortFrom(addr.Unmap(), Ntohs(port))
+}
+
+// Local returns the source address and port of the socket.
+// IPv4-mapped IPv6 addresses are returned as IPv4 addresses.
+// For a family other than AF_INET or AF_INET6 an invalid netip.AddrPort
+// is returned.
+func (id *SockID) Local(family uint8) netip.AddrPort {
+	return toAddrPort(family, id.Src, id.SPort)
+}
+
+// Remote returns the destination address and port of the socket.
+// IPv4-mapped IPv6 addresses are returned as IPv4 addresses.
+// For a family other than AF_INET or AF_INET6 an invalid netip.AddrPort
+// is returned.
+func (id *SockID) Remote(family uint8) netip.AddrPort {
+	return toAddrPort(family, id.Dst, id.DPort)
+}
+
+// SetLocal sets the source address and port of id from ap.
+func (id *SockID) SetLocal(ap netip.AddrPort) {
+	id.Src = FromNetipAddr(ap.Addr())
+	id.SPort = Htons(ap.Port())
+}
+
+// SetRemote sets the destination address and port of id from ap.
+func (id *SockID) SetRemote(ap netip.AddrPort) {
+	id.Dst = FromNetipAddr(ap.Addr())
+	id.DPort = Htons(ap.Port())
+}
+
+// CookieValue returns the socket cookie as single value.
+func (id *SockID) CookieValue() uint64 {
+	return uint64(id.Cookie[1])<<32 | uint64(id.Cookie[0])
+}
+
+// CookieValue returns the socket cookie as single value.
+func (m *UnixDiagMsg) CookieValue() uint64 {
+	return uint64(m.Cookie[1])<<32 | uint64(m.Cookie[0])
+}
+
+// NewSockID returns a SockID for the given local and remote address.
+// It can be used in NetOption to query a specific socket.
+func NewSockID(local, remote netip.AddrPort) SockID {
+	var id SockID
+	id.SetLocal(local)
+	id.SetRemote(remote)
+	return id
+}
+
 // Ntohs converts in from network byte order to host byte order represenation.
 func Ntohs(in uint16) uint16 {
 	v := uint16((in & 0xFF) << 8)
 	v |= uint16((in >> 8) & 0xFF)
 	return v
 }
+
+// Htons converts in from host byte order to network byte order represenation.
+func Htons(in uint16) uint16 {
+	return Ntohs(in)
+}
+
+func usec(v uint32) time.Duration {
+	return time.Duration(v) * time.Microsecond
+}
+
+func msec(v uint32) time.Duration {
+	return time.Duration(v) * time.Millisecond
+}
+
+// RttDuration returns the smoothed round trip time.
+func (t *TcpInfo) RttDuration() time.Duration {
+	return usec(t.Rtt)
+}
+
+// RttvarDuration returns the round trip time variance.
+func (t *TcpInfo) RttvarDuration() time.Duration {
+	return usec(t.Rttvar)
+}
+
+// MinRttDuration returns the minimum observed round trip time.
+func (t *TcpInfo) MinRttDuration() time.Duration {
+	return usec(t.MinRtt)
+}
+
+// RcvRttDuration returns the round trip time estimated by the receiver.
+func (t *TcpInfo) RcvRttDuration() time.Duration {
+	return usec(t.RcvRtt)
+}
+
+// RtoDuration returns the retransmission timeout.
+func (t *TcpInfo) RtoDuration() time.Duration {
+	return usec(t.Rto)
+}
+
+// AtoDuration returns the delayed ACK timeout.
+func (t *TcpInfo) AtoDuration() time.Duration {
+	return usec(t.Ato)
+}
+
+// LastDataSentDuration returns the time since data was last sent.
+func (t *TcpInfo) LastDataSentDuration() time.Duration {
+	return msec(t.LastDataSent)
+}
+
+// LastAckSentDuration returns the time since an ACK was last sent.
+// The kernel does not track this value and always reports 0.
+func (t *TcpInfo) LastAckSentDuration() time.Duration {
+	return msec(t.LastAckSent)
+}
+
+// LastDataRecvDuration returns the time since data was last received.
+func (t *TcpInfo) LastDataRecvDuration() time.Duration {
+	return msec(t.LastDataRecv)
+}
+
+// LastAckRecvDuration returns the time since an ACK was last received.
+func (t *TcpInfo) LastAckRecvDuration() time.Duration {
+	return msec(t.LastAckRecv)
+}
+
+// BusyTimeDuration returns the time the socket was busy sending data.
+func (t *TcpInfo) BusyTimeDuration() time.Duration {
+	return time.Duration(t.BusyTime) * time.Microsecond
+}
+
+// RwndLimitedDuration returns the time sending was limited by the receive window.
+func (t *TcpInfo) RwndLimitedDuration() time.Duration {
+	return time.Duration(t.RwndLimited) * time.Microsecond
+}
+
+// SndbufLimitedDuration returns the time sending was limited by the send buffer.
+func (t *TcpInfo) SndbufLimitedDuration() time.Duration {
+	return time.Duration(t.SndbufLimited) * time.Microsecond
+}
+
+// TotalRtoTimeDuration returns the time spent in RTO recoveries.
+func (t *TcpInfo) TotalRtoTimeDuration() time.Duration {
+	return msec(t.TotalRtoTime)
+}
+
+// bytesToBits converts a rate in bytes per second to bits per second.
+// Unlimited rates, reported by the kernel as ^uint64(0), and rates that
+// do not fit into an uint64 return math.MaxUint64.
+func bytesToBits(bytesPerSec uint64) uint64 {
+	if bytesPerSec > math.MaxUint64/8 {
+		return math.MaxUint64
+	}
+	return bytesPerSec * 8
+}
+
+// PacingRateBps returns the pacing rate in bits per second. It returns
+// math.MaxUint64, if the pacing rate is unlimited.
+func (t *TcpInfo) PacingRateBps() uint64 {
+	return bytesToBits(t.PacingRate)
+}
+
+// MaxPacingRateBps returns the maximum pacing rate in bits per second. It
+// returns math.MaxUint64, if the pacing rate is unlimited.
+func (t *TcpInfo) MaxPacingRateBps() uint64 {
+	return bytesToBits(t.MaxPacingRate)
+}
+
+// DeliveryRateBps returns the delivery rate in bits per second.
+func (t *TcpInfo) DeliveryRateBps() uint64 {
+	return bytesToBits(t.DeliveryRate)
+}
+
+// bbrUnit is the fixed point scaling factor of BBR gains.
+const bbrUnit = 1 << 8
+
+// Bandwidth returns the max-filtered bandwidth estimate in bytes per second.
+func (b *BBRInfo) Bandwidth() uint64 {
+	return uint64(b.BwHi)<<32 | uint64(b.BwLo)
+}
+
+// BandwidthBps returns the max-filtered bandwidth estimate in bits per second.
+func (b *BBRInfo) BandwidthBps() uint64 {
+	return bytesToBits(b.Bandwidth())
+}
+
+// MinRTTDuration returns the min-filtered round trip time.
+func (b *BBRInfo) MinRTTDuration() time.Duration {
+	return usec(b.MinRTT)
+}
+
+// PacingGainRatio returns the pacing gain as ratio.
+func (b *BBRInfo) PacingGainRatio() float64 {
+	return float64(b.PacingGain) / bbrUnit
+}
+
+// CwndGainRatio returns the congestion window gain as ratio.
+func (b *BBRInfo) CwndGainRatio() float64 {
+	return float64(b.CwndGaing) / bbrUnit
+}
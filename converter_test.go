@@ -0,0 +1,130 @@
+package diag
+
+import (
+	"math"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestTcpInfoDurations(t *testing.T) {
+	info := TcpInfo{
+		Rtt:          1500,
+		MinRtt:       250,
+		Rto:          204000,
+		LastDataRecv: 42,
+		PacingRate:   125000,
+	}
+
+	if got := info.RttDuration(); got != 1500*time.Microsecond {
+		t.Fatalf("RttDuration: got %v", got)
+	}
+	if got := info.MinRttDuration(); got != 250*time.Microsecond {
+		t.Fatalf("MinRttDuration: got %v", got)
+	}
+	if got := info.RtoDuration(); got != 204*time.Millisecond {
+		t.Fatalf("RtoDuration: got %v", got)
+	}
+	if got := info.LastDataRecvDuration(); got != 42*time.Millisecond {
+		t.Fatalf("LastDataRecvDuration: got %v", got)
+	}
+	if got := info.PacingRateBps(); got != 1000000 {
+		t.Fatalf("PacingRateBps: got %d", got)
+	}
+}
+
+func TestTcpInfoRateOverflow(t *testing.T) {
+	info := TcpInfo{
+		PacingRate:    ^uint64(0),
+		MaxPacingRate: ^uint64(0),
+		DeliveryRate:  math.MaxUint64/8 + 1,
+	}
+	if got := info.PacingRateBps(); got != math.MaxUint64 {
+		t.Fatalf("PacingRateBps: got %d", got)
+	}
+	if got := info.MaxPacingRateBps(); got != math.MaxUint64 {
+		t.Fatalf("MaxPacingRateBps: got %d", got)
+	}
+	if got := info.DeliveryRateBps(); got != math.MaxUint64 {
+		t.Fatalf("DeliveryRateBps: got %d", got)
+	}
+	info.DeliveryRate = math.MaxUint64 / 8
+	if got := info.DeliveryRateBps(); got != math.MaxUint64/8*8 {
+		t.Fatalf("DeliveryRateBps: got %d", got)
+	}
+
+	bbr := BBRInfo{BwLo: ^uint32(0), BwHi: ^uint32(0)}
+	if got := bbr.BandwidthBps(); got != math.MaxUint64 {
+		t.Fatalf("BandwidthBps: got %d", got)
+	}
+}
+
+func TestBBRInfo(t *testing.T) {
+	info := BBRInfo{
+		BwLo:       0x10,
+		BwHi:       0x1,
+		MinRTT:     3000,
+		PacingGain: 739,
+		CwndGaing:  512,
+	}
+
+	if got := info.Bandwidth(); got != 0x100000010 {
+		t.Fatalf("Bandwidth: got 0x%x", got)
+	}
+	if got := info.BandwidthBps(); got != 0x100000010*8 {
+		t.Fatalf("BandwidthBps: got 0x%x", got)
+	}
+	if got := info.MinRTTDuration(); got != 3*time.Millisecond {
+		t.Fatalf("MinRTTDuration: got %v", got)
+	}
+	if got := info.CwndGainRatio(); got != 2 {
+		t.Fatalf("CwndGainRatio: got %v", got)
+	}
+	if got := info.PacingGainRatio(); got < 2.88 || got > 2.89 {
+		t.Fatalf("PacingGainRatio: got %v", got)
+	}
+}
+
+func TestSockIDAddrPort(t *testing.T) {
+	tests := map[string]struct {
+		family uint8
+		local  netip.AddrPort
+		remote netip.AddrPort
+	}{
+		"inet": {
+			family: unix.AF_INET,
+			local:  netip.MustParseAddrPort("127.0.0.2:1234"),
+			remote: netip.MustParseAddrPort("10.0.0.1:443"),
+		},
+		"inet6": {
+			family: unix.AF_INET6,
+			local:  netip.MustParseAddrPort("[::1]:5432"),
+			remote: netip.MustParseAddrPort("[2001:db8::1]:80"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			id := NewSockID(test.local, test.remote)
+			if got := id.Local(test.family); got != test.local {
+				t.Fatalf("Local: expected %v, got %v", test.local, got)
+			}
+			if got := id.Remote(test.family); got != test.remote {
+				t.Fatalf("Remote: expected %v, got %v", test.remote, got)
+			}
+		})
+	}
+}
+
+func TestSockIDUnmap(t *testing.T) {
+	mapped := netip.MustParseAddrPort("[::ffff:192.0.2.1]:8080")
+	id := NewSockID(mapped, netip.AddrPort{})
+	if got := id.Local(unix.AF_INET6); got != netip.MustParseAddrPort("192.0.2.1:8080") {
+		t.Fatalf("expected unmapped address, got %v", got)
+	}
+	if got := id.Local(unix.AF_UNIX); got.IsValid() {
+		t.Fatalf("expected invalid address for AF_UNIX, got %v", got)
+	}
+}
@@ -0,0 +1,722 @@
+package diag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// Sizes of the structs as sent by the kernel.
+var (
+	sizeOfDiagMsg     = binary.Size(DiagMsg{})
+	sizeOfMemInfo     = binary.Size(MemInfo{})
+	sizeOfSkMemInfo   = binary.Size(SkMemInfo{})
+	sizeOfVegasInfo   = binary.Size(VegasInfo{})
+	sizeOfDCTCPInfo   = binary.Size(DCTCPInfo{})
+	sizeOfBBRInfo     = binary.Size(BBRInfo{})
+	sizeOfSockOpt     = binary.Size(SockOpt{})
+	sizeOfUnixDiagMsg = binary.Size(UnixDiagMsg{})
+	sizeOfUnixDiagVfs = binary.Size(UnixDiagVfs{})
+	sizeOfUnixRqLen   = binary.Size(UnixDiagRqLen{})
+)
+
+// structDecoder reads the fields of a struct in native endian without
+// reflection. Fields beyond the end of b are read as zero.
+type structDecoder struct {
+	b []byte
+}
+
+// newStructDecoder returns a structDecoder for a struct of size bytes. Like
+// binary.Read, it returns io.EOF for empty and io.ErrUnexpectedEOF for short
+// data. All fields are read as zero in this case.
+func newStructDecoder(b []byte, size int) (structDecoder, error) {
+	switch {
+	case len(b) == 0:
+		return structDecoder{}, io.EOF
+	case len(b) < size:
+		return structDecoder{}, io.ErrUnexpectedEOF
+	}
+	return structDecoder{b: b}, nil
+}
+
+// next returns the next n bytes. If b is too short, they are padded with
+// zeros into buf.
+func (d *structDecoder) next(n int, buf []byte) []byte {
+	if len(d.b) >= n {
+		v := d.b[:n]
+		d.b = d.b[n:]
+		return v
+	}
+	copy(buf, d.b)
+	d.b = nil
+	return buf
+}
+
+func (d *structDecoder) uint8() uint8 {
+	if len(d.b) == 0 {
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *structDecoder) uint16() uint16 {
+	var buf [2]byte
+	return nativeEndian.Uint16(d.next(2, buf[:]))
+}
+
+func (d *structDecoder) uint32() uint32 {
+	var buf [4]byte
+	return nativeEndian.Uint32(d.next(4, buf[:]))
+}
+
+func (d *structDecoder) uint64() uint64 {
+	var buf [8]byte
+	return nativeEndian.Uint64(d.next(8, buf[:]))
+}
+
+func (d *structDecoder) bytes(dst []byte) {
+	n := copy(dst, d.b)
+	clear(dst[n:])
+	d.b = d.b[n:]
+}
+
+func (m *DiagMsg) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfDiagMsg)
+	m.Family = d.uint8()
+	m.State = d.uint8()
+	m.Timer = d.uint8()
+	m.Retrans = d.uint8()
+	m.ID.decode(&d)
+	m.Expires = d.uint32()
+	m.RQueue = d.uint32()
+	m.WQueue = d.uint32()
+	m.UID = d.uint32()
+	m.INode = d.uint32()
+	return err
+}
+
+func (id *SockID) decode(d *structDecoder) {
+	id.SPort = d.uint16()
+	id.DPort = d.uint16()
+	for i := range id.Src {
+		id.Src[i] = d.uint32()
+	}
+	for i := range id.Dst {
+		id.Dst[i] = d.uint32()
+	}
+	id.If = d.uint32()
+	for i := range id.Cookie {
+		id.Cookie[i] = d.uint32()
+	}
+}
+
+func (m *MemInfo) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfMemInfo)
+	m.RMem = d.uint32()
+	m.WMem = d.uint32()
+	m.FMem = d.uint32()
+	m.TMem = d.uint32()
+	return err
+}
+
+func (m *SkMemInfo) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfSkMemInfo)
+	m.RMemAlloc = d.uint32()
+	m.RcvBuff = d.uint32()
+	m.WMemAlloc = d.uint32()
+	m.SndBuff = d.uint32()
+	m.FwdAlloc = d.uint32()
+	m.WMemQueued = d.uint32()
+	m.OptMem = d.uint32()
+	m.Backlog = d.uint32()
+	m.Drops = d.uint32()
+	return err
+}
+
+func (v *VegasInfo) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfVegasInfo)
+	v.Enabled = d.uint32()
+	v.RttCnt = d.uint32()
+	v.Rtt = d.uint32()
+	v.MinRtt = d.uint32()
+	return err
+}
+
+func (v *DCTCPInfo) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfDCTCPInfo)
+	v.Enabeld = d.uint16()
+	v.CeState = d.uint16()
+	v.Alpha = d.uint32()
+	v.AbECN = d.uint32()
+	v.AbTot = d.uint32()
+	return err
+}
+
+func (v *BBRInfo) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfBBRInfo)
+	v.BwLo = d.uint32()
+	v.BwHi = d.uint32()
+	v.MinRTT = d.uint32()
+	v.PacingGain = d.uint32()
+	v.CwndGaing = d.uint32()
+	return err
+}
+
+func (s *SockOpt) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfSockOpt)
+	s.Bitfield1 = d.uint8()
+	s.Bitfield2 = d.uint8()
+	return err
+}
+
+// decode decodes INET_DIAG_INFO. Older kernels report fewer fields, which
+// are left zero.
+func (t *TcpInfo) decode(b []byte) {
+	d := structDecoder{b: b}
+	t.State = d.uint8()
+	t.CaState = d.uint8()
+	t.Retransmits = d.uint8()
+	t.Probes = d.uint8()
+	t.Backoff = d.uint8()
+	t.Options = d.uint8()
+	t.Wscale = d.uint8()
+	t.ClientInfo = d.uint8()
+	t.Rto = d.uint32()
+	t.Ato = d.uint32()
+	t.SndMss = d.uint32()
+	t.RcvMss = d.uint32()
+	t.Unacked = d.uint32()
+	t.Sacked = d.uint32()
+	t.Lost = d.uint32()
+	t.Retrans = d.uint32()
+	t.Fackets = d.uint32()
+	t.LastDataSent = d.uint32()
+	t.LastAckSent = d.uint32()
+	t.LastDataRecv = d.uint32()
+	t.LastAckRecv = d.uint32()
+	t.Pmtu = d.uint32()
+	t.RcvSsthresh = d.uint32()
+	t.Rtt = d.uint32()
+	t.Rttvar = d.uint32()
+	t.SndSsthresh = d.uint32()
+	t.SndCwnd = d.uint32()
+	t.Advmss = d.uint32()
+	t.Reordering = d.uint32()
+	t.RcvRtt = d.uint32()
+	t.RcvSpace = d.uint32()
+	t.RotalRetrans = d.uint32()
+	t.PacingRate = d.uint64()
+	t.MaxPacingRate = d.uint64()
+	t.BytesAcked = d.uint64()
+	t.BytesReceived = d.uint64()
+	t.SegsOut = d.uint32()
+	t.SegsIn = d.uint32()
+	t.NotsentBytes = d.uint32()
+	t.MinRtt = d.uint32()
+	t.DataSegsIn = d.uint32()
+	t.DataSegsOut = d.uint32()
+	t.DeliveryRate = d.uint64()
+	t.BusyTime = d.uint64()
+	t.RwndLimited = d.uint64()
+	t.SndbufLimited = d.uint64()
+	t.Delivered = d.uint32()
+	t.DeliveredCe = d.uint32()
+	t.BytesSent = d.uint64()
+	t.BytesRetrans = d.uint64()
+	t.DsackDups = d.uint32()
+	t.ReordSeen = d.uint32()
+	t.RcvOoopack = d.uint32()
+	t.SndWnd = d.uint32()
+	t.RcvWnd = d.uint32()
+	t.Rehash = d.uint32()
+	t.TotalRto = d.uint16()
+	t.TotalRtoRecoveries = d.uint16()
+	t.TotalRtoTime = d.uint32()
+	t.ReceivedCe = d.uint32()
+	t.DeliveredE1Bytes = d.uint32()
+	t.DeliveredE0Bytes = d.uint32()
+	t.DeliveredCeBytes = d.uint32()
+	t.ReceivedE1Bytes = d.uint32()
+	t.ReceivedE0Bytes = d.uint32()
+	t.ReceivedCeBytes = d.uint32()
+	t.AccecnFailMode = d.uint16()
+	t.AccecnOptSeen = d.uint16()
+}
+
+// decode decodes INET_DIAG_INFO of a SCTP socket. Missing fields are left
+// zero.
+func (s *SctpInfo) decode(b []byte) {
+	d := structDecoder{b: b}
+	s.Tag = d.uint32()
+	s.State = d.uint32()
+	s.Rwnd = d.uint32()
+	s.Unackdata = d.uint16()
+	s.Penddata = d.uint16()
+	s.Instrms = d.uint16()
+	s.Outstrms = d.uint16()
+	s.FragmentationPoint = d.uint32()
+	s.Inqueue = d.uint32()
+	s.Outqueue = d.uint32()
+	s.OverallError = d.uint32()
+	s.MaxBurst = d.uint32()
+	s.Maxseg = d.uint32()
+	s.PeerRwnd = d.uint32()
+	s.PeerTag = d.uint32()
+	s.PeerCapable = d.uint8()
+	s.PeerSack = d.uint8()
+	s.Reserved1 = d.uint16()
+	s.Isacks = d.uint64()
+	s.Osacks = d.uint64()
+	s.Opackets = d.uint64()
+	s.Ipackets = d.uint64()
+	s.Rtxchunks = d.uint64()
+	s.Outofseqtsns = d.uint64()
+	s.Idupchunks = d.uint64()
+	s.Gapcnt = d.uint64()
+	s.Ouodchunks = d.uint64()
+	s.Iuodchunks = d.uint64()
+	s.Oodchunks = d.uint64()
+	s.Iodchunks = d.uint64()
+	s.Octrlchunks = d.uint64()
+	s.Ictrlchunks = d.uint64()
+	s.SockaddrStorage.Family = d.uint16()
+	d.bytes(s.SockaddrStorage.Data[:])
+	s.PState = int32(d.uint32())
+	s.PCwnd = d.uint32()
+	s.PSrtt = d.uint32()
+	s.PRto = d.uint32()
+	s.PHbinterval = d.uint32()
+	s.PPathmaxrxt = d.uint32()
+	s.PSackdelay = d.uint32()
+	s.PSackfreq = d.uint32()
+	s.PSsthresh = d.uint32()
+	s.PPartial_bytes_acked = d.uint32()
+	s.PFlight_size = d.uint32()
+	s.PError = d.uint16()
+	s.Reserved2 = d.uint16()
+	s.SAutoclose = d.uint32()
+	s.SAdaptation_ind = d.uint32()
+	s.SPdPoint = d.uint32()
+	s.SNodelay = d.uint8()
+	s.SDisableFragments = d.uint8()
+	s.Sv4mapped = d.uint8()
+	s.SFragInterleave = d.uint8()
+	s.SType = d.uint32()
+	s.Reserved3 = d.uint32()
+}
+
+func (m *UnixDiagMsg) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfUnixDiagMsg)
+	m.Family = d.uint8()
+	m.Type = d.uint8()
+	m.State = d.uint8()
+	m.Pad = d.uint8()
+	m.Ino = d.uint32()
+	for i := range m.Cookie {
+		m.Cookie[i] = d.uint32()
+	}
+	return err
+}
+
+func (v *UnixDiagVfs) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfUnixDiagVfs)
+	v.Ino = d.uint32()
+	v.Dev = d.uint32()
+	return err
+}
+
+func (r *UnixDiagRqLen) decode(b []byte) error {
+	d, err := newStructDecoder(b, sizeOfUnixRqLen)
+	r.RQueue = d.uint32()
+	r.WQueue = d.uint32()
+	return err
+}
+
+// Based on NLA_TYPE_MASK and NLA_HDRLEN in include/uapi/linux/netlink.h
+const (
+	attrTypeMask  = 0x3fff
+	attrHeaderLen = 4
+)
+
+var errInvalidAttribute = errors.New("invalid attribute; length too short or too large")
+
+// attrDecoder iterates over netlink attributes like netlink.AttributeDecoder,
+// but returns the data of the attributes without copying it.
+type attrDecoder struct {
+	b       []byte
+	attr    uint16
+	payload []byte
+	err     error
+}
+
+func (ad *attrDecoder) next() bool {
+	if ad.err != nil || len(ad.b) == 0 {
+		return false
+	}
+	if len(ad.b) < attrHeaderLen {
+		ad.err = errInvalidAttribute
+		return false
+	}
+	length := int(nativeEndian.Uint16(ad.b[0:2]))
+	if length > len(ad.b) || (length != 0 && length < attrHeaderLen) {
+		ad.err = errInvalidAttribute
+		return false
+	}
+	// Zero length attributes are skipped by a header's length.
+	length = max(length, attrHeaderLen)
+	ad.attr = nativeEndian.Uint16(ad.b[2:4]) & attrTypeMask
+	ad.payload = ad.b[attrHeaderLen:length]
+	ad.b = ad.b[min(nlaAlign(length), len(ad.b)):]
+	return true
+}
+
+func nlaAlign(length int) int {
+	return (length + attrHeaderLen - 1) &^ (attrHeaderLen - 1)
+}
+
+// typ returns the type of the current attribute without flags.
+func (ad *attrDecoder) typ() uint16 { return ad.attr }
+
+// bytes returns the data of the current attribute. It is only valid as long
+// as the decoded data.
+func (ad *attrDecoder) bytes() []byte { return ad.payload }
+
+// string returns the data of the current attribute without trailing null
+// bytes.
+func (ad *attrDecoder) string() []byte { return bytes.TrimRight(ad.payload, "\x00") }
+
+func (ad *attrDecoder) uint8() uint8 {
+	if !ad.check(1, "uint8") {
+		return 0
+	}
+	return ad.payload[0]
+}
+
+func (ad *attrDecoder) uint32() uint32 {
+	if !ad.check(4, "uint32") {
+		return 0
+	}
+	return nativeEndian.Uint32(ad.payload)
+}
+
+func (ad *attrDecoder) uint64() uint64 {
+	if !ad.check(8, "uint64") {
+		return 0
+	}
+	return nativeEndian.Uint64(ad.payload)
+}
+
+// check stops the iteration, if the current attribute is not of size bytes.
+func (ad *attrDecoder) check(size int, name string) bool {
+	if ad.err != nil {
+		return false
+	}
+	if len(ad.payload) != size {
+		ad.err = fmt.Errorf("netlink: attribute %d is not a %s; length: %d",
+			ad.attr, name, len(ad.payload))
+		return false
+	}
+	return true
+}
+
+// Kinds of INET_DIAG_INFO.
+const (
+	infoNone = iota
+	infoTCP
+	infoSCTP
+)
+
+// netValues holds the decoded attributes of an inet_diag_msg. NetAttribute
+// either refers to them or gets copies of them.
+type netValues struct {
+	// present has a bit set for every decoded attribute.
+	present  NetAttrMask
+	infoKind int
+
+	memInfo   MemInfo
+	vegasInfo VegasInfo
+	cong      string
+	tos       uint8
+	tclass    uint8
+	skMemInfo SkMemInfo
+	shutdown  uint8
+	dctcpInfo DCTCPInfo
+	protocol  uint8
+	v6Only    uint8
+	mark      uint32
+	bbrInfo   BBRInfo
+	classID   uint32
+	cgroupID  uint64
+	sockOpt   SockOpt
+	tcpInfo   TcpInfo
+	sctpInfo  SctpInfo
+}
+
+func (v *netValues) has(attrType uint16) bool {
+	return v.present&(1<<attrType) != 0
+}
+
+// decode decodes the attributes in data. Unknown attributes are appended to
+// info.Unknown and refer to data.
+func (v *netValues) decode(data []byte, info *NetAttribute, opts decodeOptions) error {
+	v.present = 0
+	v.infoKind = infoNone
+
+	ad := attrDecoder{b: data}
+	var infoData []byte
+	var protocol uint8
+	var hasProtocol bool
+	var multiError error
+	for ad.next() {
+		adType := ad.typ()
+		if adType == inetDiagProtocol {
+			// INET_DIAG_PROTOCOL is needed to decode INET_DIAG_INFO.
+			protocol = ad.uint8()
+			hasProtocol = true
+		}
+		if !opts.netAttrs.has(adType) {
+			continue
+		}
+		var err error
+		switch adType {
+		case inetDiagNone, inetDiagPad:
+			// nothing to do here.
+			continue
+		case inetDiagMemInfo:
+			err = v.memInfo.decode(ad.bytes())
+		case inetDiagInfo:
+			infoData = ad.bytes()
+			info.InfoLen = len(infoData)
+			continue
+		case inetDiagVegasInfo:
+			err = v.vegasInfo.decode(ad.bytes())
+		case inetDiagCong:
+			// Avoid allocating the same name again.
+			if cong := ad.string(); string(cong) != v.cong {
+				v.cong = string(cong)
+			}
+		case inetDiagTOS:
+			v.tos = ad.uint8()
+		case inetDiagTClass:
+			v.tclass = ad.uint8()
+		case inetDiagSKMemInfo:
+			err = v.skMemInfo.decode(ad.bytes())
+		case inetDiagShutdown:
+			v.shutdown = ad.uint8()
+		case inetDiagDCTCPInfo:
+			err = v.dctcpInfo.decode(ad.bytes())
+		case inetDiagProtocol:
+			v.protocol = protocol
+		case inetDiagSKV6Only:
+			v.v6Only = ad.uint8()
+		case inetDiagMark:
+			v.mark = ad.uint32()
+		case inetDiagBBRInfo:
+			err = v.bbrInfo.decode(ad.bytes())
+		case inetDiagClassID:
+			v.classID = ad.uint32()
+		case inetDiagCGroupID:
+			v.cgroupID = ad.uint64()
+		case inetDiagSockOpt:
+			err = v.sockOpt.decode(ad.bytes())
+		default:
+			err := opts.unknown(decodeError(int(adType), ad.bytes(),
+				fmt.Errorf("net type %d not implemented", adType)))
+			multiError = errors.Join(multiError, err)
+			info.Unknown = append(info.Unknown, RawAttribute{
+				Type: adType,
+				Data: ad.bytes(),
+			})
+			continue
+		}
+		v.present |= 1 << adType
+		if err != nil {
+			multiError = errors.Join(multiError, decodeError(int(adType), ad.bytes(), err))
+		}
+	}
+	if err := errors.Join(multiError, decodeError(-1, data, ad.err)); err != nil {
+		return err
+	}
+	if len(infoData) == 0 {
+		return nil
+	}
+
+	// When asking for a specific socket, no INET_DIAG_PROTOCOL attribute
+	// is returned...
+	switch {
+	case !hasProtocol || protocol == unix.IPPROTO_TCP:
+		v.tcpInfo.decode(infoData)
+		v.infoKind = infoTCP
+	case protocol == unix.IPPROTO_SCTP:
+		v.sctpInfo.decode(infoData)
+		v.infoKind = infoSCTP
+	default:
+		err := opts.unknown(decodeError(inetDiagInfo, infoData,
+			fmt.Errorf("unhandled IPPROTO (%d) for INET_DIAG_INFO", protocol)))
+		multiError = errors.Join(multiError, err)
+		info.Unknown = append(info.Unknown, RawAttribute{
+			Type: inetDiagInfo,
+			Data: infoData,
+		})
+	}
+	return multiError
+}
+
+// refer sets the elements of info to the values in v.
+func (v *netValues) refer(info *NetAttribute) {
+	if v.has(inetDiagMemInfo) {
+		info.MemInfo = &v.memInfo
+	}
+	if v.has(inetDiagVegasInfo) {
+		info.VegasInfo = &v.vegasInfo
+	}
+	if v.has(inetDiagCong) {
+		info.Cong = &v.cong
+	}
+	if v.has(inetDiagTOS) {
+		info.TOS = &v.tos
+	}
+	if v.has(inetDiagTClass) {
+		info.TClass = &v.tclass
+	}
+	if v.has(inetDiagSKMemInfo) {
+		info.SkMemInfo = &v.skMemInfo
+	}
+	if v.has(inetDiagShutdown) {
+		info.Shutdown = &v.shutdown
+	}
+	if v.has(inetDiagDCTCPInfo) {
+		info.DCTCPInfo = &v.dctcpInfo
+	}
+	if v.has(inetDiagProtocol) {
+		info.Protocol = &v.protocol
+	}
+	if v.has(inetDiagSKV6Only) {
+		info.SKV6Only = &v.v6Only
+	}
+	if v.has(inetDiagMark) {
+		info.Mark = &v.mark
+	}
+	if v.has(inetDiagBBRInfo) {
+		info.BBRInfo = &v.bbrInfo
+	}
+	if v.has(inetDiagClassID) {
+		info.ClassID = &v.classID
+	}
+	if v.has(inetDiagCGroupID) {
+		info.CGroupID = &v.cgroupID
+	}
+	if v.has(inetDiagSockOpt) {
+		info.SockOpt = &v.sockOpt
+	}
+	switch v.infoKind {
+	case infoTCP:
+		info.TcpInfo = &v.tcpInfo
+	case infoSCTP:
+		info.SctpInfo = &v.sctpInfo
+	}
+}
+
+// copyTo sets the elements of info to copies of the values in v.
+func (v *netValues) copyTo(info *NetAttribute) {
+	if v.has(inetDiagMemInfo) {
+		mi := v.memInfo
+		info.MemInfo = &mi
+	}
+	if v.has(inetDiagVegasInfo) {
+		vi := v.vegasInfo
+		info.VegasInfo = &vi
+	}
+	if v.has(inetDiagCong) {
+		info.Cong = stringPtr(v.cong)
+	}
+	if v.has(inetDiagTOS) {
+		info.TOS = uint8Ptr(v.tos)
+	}
+	if v.has(inetDiagTClass) {
+		info.TClass = uint8Ptr(v.tclass)
+	}
+	if v.has(inetDiagSKMemInfo) {
+		si := v.skMemInfo
+		info.SkMemInfo = &si
+	}
+	if v.has(inetDiagShutdown) {
+		info.Shutdown = uint8Ptr(v.shutdown)
+	}
+	if v.has(inetDiagDCTCPInfo) {
+		di := v.dctcpInfo
+		info.DCTCPInfo = &di
+	}
+	if v.has(inetDiagProtocol) {
+		info.Protocol = uint8Ptr(v.protocol)
+	}
+	if v.has(inetDiagSKV6Only) {
+		info.SKV6Only = uint8Ptr(v.v6Only)
+	}
+	if v.has(inetDiagMark) {
+		info.Mark = uint32Ptr(v.mark)
+	}
+	if v.has(inetDiagBBRInfo) {
+		bbrInfo := v.bbrInfo
+		info.BBRInfo = &bbrInfo
+	}
+	if v.has(inetDiagClassID) {
+		info.ClassID = uint32Ptr(v.classID)
+	}
+	if v.has(inetDiagCGroupID) {
+		info.CGroupID = uint64Ptr(v.cgroupID)
+	}
+	if v.has(inetDiagSockOpt) {
+		so := v.sockOpt
+		info.SockOpt = &so
+	}
+	switch v.infoKind {
+	case infoTCP:
+		tcpInfo := v.tcpInfo
+		info.TcpInfo = &tcpInfo
+	case infoSCTP:
+		sctpInfo := v.sctpInfo
+		info.SctpInfo = &sctpInfo
+	}
+	for i := range info.Unknown {
+		info.Unknown[i].Data = bytes.Clone(info.Unknown[i].Data)
+	}
+}
+
+// NetDecoder decodes inet_diag messages into a NetObject owned by the caller
+// without allocations. The elements of NetAttribute refer to values owned by
+// the NetDecoder, that are overwritten by the next call of Decode. Use
+// NetDump to keep the sockets instead. A NetDecoder must not be used
+// concurrently.
+type NetDecoder struct {
+	opts   decodeOptions
+	values netValues
+}
+
+// NewNetDecoder returns a NetDecoder that decodes messages like a Diag opened
+// with config.
+func NewNetDecoder(config *Config) *NetDecoder {
+	if config == nil {
+		config = &Config{}
+	}
+	return &NetDecoder{opts: config.decodeOptions()}
+}
+
+// Decode decodes data, the payload of a netlink message, into obj. All
+// elements of obj are reset, but the capacity of obj.Unknown is reused.
+// Unknown attributes refer to data.
+func (d *NetDecoder) Decode(data []byte, obj *NetObject) error {
+	*obj = NetObject{NetAttribute: NetAttribute{Unknown: obj.Unknown[:0]}}
+	if err := decodeNetHeader(data, &obj.DiagMsg); err != nil || d.opts.skipOptional {
+		return err
+	}
+	err := d.values.decode(data[sizeOfDiagMsg:], &obj.NetAttribute, d.opts)
+	d.values.refer(&obj.NetAttribute)
+	return err
+}
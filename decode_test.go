@@ -0,0 +1,210 @@
+package diag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestStructDecoders(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := map[string]struct {
+		value  interface{}
+		decode func(b []byte) (interface{}, error)
+	}{
+		"DiagMsg": {&DiagMsg{}, func(b []byte) (interface{}, error) {
+			var v DiagMsg
+			return &v, v.decode(b)
+		}},
+		"MemInfo": {&MemInfo{}, func(b []byte) (interface{}, error) {
+			var v MemInfo
+			return &v, v.decode(b)
+		}},
+		"SkMemInfo": {&SkMemInfo{}, func(b []byte) (interface{}, error) {
+			var v SkMemInfo
+			return &v, v.decode(b)
+		}},
+		"VegasInfo": {&VegasInfo{}, func(b []byte) (interface{}, error) {
+			var v VegasInfo
+			return &v, v.decode(b)
+		}},
+		"DCTCPInfo": {&DCTCPInfo{}, func(b []byte) (interface{}, error) {
+			var v DCTCPInfo
+			return &v, v.decode(b)
+		}},
+		"BBRInfo": {&BBRInfo{}, func(b []byte) (interface{}, error) {
+			var v BBRInfo
+			return &v, v.decode(b)
+		}},
+		"SockOpt": {&SockOpt{}, func(b []byte) (interface{}, error) {
+			var v SockOpt
+			return &v, v.decode(b)
+		}},
+		"TcpInfo": {&TcpInfo{}, func(b []byte) (interface{}, error) {
+			var v TcpInfo
+			v.decode(b)
+			return &v, nil
+		}},
+		"SctpInfo": {&SctpInfo{}, func(b []byte) (interface{}, error) {
+			var v SctpInfo
+			v.decode(b)
+			return &v, nil
+		}},
+		"UnixDiagMsg": {&UnixDiagMsg{}, func(b []byte) (interface{}, error) {
+			var v UnixDiagMsg
+			return &v, v.decode(b)
+		}},
+		"UnixDiagVfs": {&UnixDiagVfs{}, func(b []byte) (interface{}, error) {
+			var v UnixDiagVfs
+			return &v, v.decode(b)
+		}},
+		"UnixDiagRqLen": {&UnixDiagRqLen{}, func(b []byte) (interface{}, error) {
+			var v UnixDiagRqLen
+			return &v, v.decode(b)
+		}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := make([]byte, binary.Size(tc.value))
+			rnd.Read(data)
+			if err := binary.Read(bytes.NewReader(data), nativeEndian, tc.value); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tc.decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.value) {
+				t.Fatalf("expected %+v, got %+v", tc.value, got)
+			}
+			if _, err := tc.decode(data[:len(data)-1]); err == nil &&
+				name != "TcpInfo" && name != "SctpInfo" {
+				t.Fatal("expected error for short data")
+			}
+		})
+	}
+}
+
+func TestTcpInfoDecodeShort(t *testing.T) {
+	data := make([]byte, binary.Size(TcpInfo{}))
+	for i := range data {
+		data[i] = byte(i)
+	}
+	// Older kernels report fewer fields, also in the middle of a field.
+	for _, n := range []int{0, 7, 104, 105} {
+		var expected TcpInfo
+		padded := make([]byte, len(data))
+		copy(padded, data[:n])
+		if err := binary.Read(bytes.NewReader(padded), nativeEndian, &expected); err != nil {
+			t.Fatal(err)
+		}
+		var got TcpInfo
+		got.decode(data[:n])
+		if got != expected {
+			t.Fatalf("%d bytes: expected %+v, got %+v", n, expected, got)
+		}
+	}
+}
+
+func testNetMessages(tb testing.TB) [][]byte {
+	tb.Helper()
+	cong, tos, tcp := "cubic", uint8(0x10), uint8(unix.IPPROTO_TCP)
+	mark := uint32(42)
+	id := NewSockID(netip.MustParseAddrPort("192.0.2.1:443"),
+		netip.MustParseAddrPort("192.0.2.2:50000"))
+	objs := []NetObject{{
+		DiagMsg: DiagMsg{Family: unix.AF_INET, State: uint8(StateEstablished), ID: id},
+		NetAttribute: NetAttribute{
+			MemInfo:   &MemInfo{RMem: 1, WMem: 2},
+			Cong:      &cong,
+			TOS:       &tos,
+			SkMemInfo: &SkMemInfo{RMemAlloc: 1, Drops: 9},
+			Protocol:  &tcp,
+			Mark:      &mark,
+			SockOpt:   &SockOpt{Bitfield1: 0x02},
+			TcpInfo:   &TcpInfo{State: uint8(StateEstablished), Rtt: 1000, BytesAcked: 1 << 40},
+			InfoLen:   binary.Size(TcpInfo{}),
+		},
+	}, {
+		DiagMsg: DiagMsg{Family: unix.AF_INET, State: uint8(StateListen)},
+		NetAttribute: NetAttribute{
+			SkMemInfo: &SkMemInfo{RcvBuff: 4096},
+			Protocol:  &tcp,
+			TcpInfo:   &TcpInfo{State: uint8(StateListen)},
+			InfoLen:   binary.Size(TcpInfo{}),
+		},
+	}}
+
+	msgs := make([][]byte, 0, len(objs))
+	for _, obj := range objs {
+		data, err := obj.MarshalBinary()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		msgs = append(msgs, data)
+	}
+	return msgs
+}
+
+func TestNetDecoder(t *testing.T) {
+	msgs := testNetMessages(t)
+	dec := NewNetDecoder(nil)
+	var obj NetObject
+	for i, data := range msgs {
+		var expected NetObject
+		if err := decodeNetMessage(data, &expected, decodeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := dec.Decode(data, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(obj, expected) {
+			t.Fatalf("message %d: expected %+v, got %+v", i, expected.NetAttribute, obj.NetAttribute)
+		}
+	}
+}
+
+func TestNetDecoderAllocs(t *testing.T) {
+	msgs := testNetMessages(t)
+	dec := NewNetDecoder(nil)
+	var obj NetObject
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, data := range msgs {
+			if err := dec.Decode(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkDecodeNetMessage(b *testing.B) {
+	data := testNetMessages(b)[0]
+	b.ReportAllocs()
+	for b.Loop() {
+		var obj NetObject
+		if err := decodeNetMessage(data, &obj, decodeOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNetDecoder(b *testing.B) {
+	data := testNetMessages(b)[0]
+	dec := NewNetDecoder(nil)
+	var obj NetObject
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := dec.Decode(data, &obj); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
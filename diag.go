@@ -1,9 +1,7 @@
 package diag
 
 import (
-	"encoding/binary"
-	"errors"
-	"fmt"
+	"io"
 	"time"
 
 	"github.com/florianl/go-diag/internal/unix"
@@ -26,25 +24,64 @@ var _ diagConn = &netlink.Conn{}
 
 // Diag represents a netlink wrapper
 type Diag struct {
-	con          diagConn
-	skipOptional bool
+	con    diagConn
+	decode decodeOptions
 }
 
 // Open establishes a netlink socket for traffic control
 func Open(config *Config) (*Diag, error) {
-	var diag Diag
-
 	if config == nil {
 		config = &Config{}
 	}
 
 	con, err := netlink.Dial(unix.NETLINK_SOCK_DIAG, &netlink.Config{NetNS: config.NetNS})
 	if err != nil {
+		return nil, netlinkError(err)
+	}
+	diag, err := OpenConn(con, config)
+	if err != nil {
+		con.Close()
 		return nil, err
 	}
-	diag.con = con
+	return diag, nil
+}
+
+// OpenConn returns a Diag that uses the established connection con, like
+// one of nltest.Dial. Config.NetNS is ignored.
+func OpenConn(con *netlink.Conn, config *Config) (*Diag, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	for _, opt := range []struct {
+		option netlink.ConnOption
+		enable bool
+	}{
+		{netlink.ExtendedAcknowledge, config.ExtendedAcknowledge},
+		{netlink.GetStrictCheck, config.StrictCheck},
+	} {
+		if !opt.enable {
+			continue
+		}
+		if err := con.SetOption(opt.option, true); err != nil {
+			return nil, netlinkError(err)
+		}
+	}
+
+	return newDiag(con, config), nil
+}
 
-	return &diag, nil
+func newDiag(con diagConn, config *Config) *Diag {
+	if config.Record != nil {
+		w := config.capture
+		if w == nil {
+			w = newCaptureWriter(config.Record)
+		}
+		con = newRecorder(con, w, config.captureNetNS)
+	}
+	return &Diag{
+		con:    con,
+		decode: config.decodeOptions(),
+	}
 }
 
 // SetOption allows to enable or disable netlink socket options.
@@ -58,132 +95,28 @@ func (d *Diag) Close() error {
 }
 
 func (d *Diag) query(req netlink.Message) ([]netlink.Message, error) {
+	toError := netlinkError
+	if req.Header.Flags&netlink.Dump != 0 {
+		toError = dumpError
+	}
+
 	verify, err := d.con.Send(req)
 	if err != nil {
-		return nil, err
+		return nil, toError(err)
 	}
 
 	if err := netlink.Validate(req, []netlink.Message{verify}); err != nil {
 		return nil, err
 	}
 
-	return d.con.Receive()
-}
-
-func extractAttributes(data []byte, info *NetAttribute) error {
-	ad, err := netlink.NewAttributeDecoder(data)
+	msgs, err := d.con.Receive()
 	if err != nil {
-		return err
+		return nil, toError(err)
 	}
-	var infoData []byte
-	var multiError error
-	for ad.Next() {
-		switch adType := ad.Type(); adType {
-		case inetDiagNone:
-			// nothing to do here.
-			continue
-		case inetDiagMemInfo:
-			mi := &MemInfo{}
-			err := unmarshalStruct(ad.Bytes(), mi)
-			multiError = errors.Join(multiError, err)
-			info.MemInfo = mi
-		case inetDiagInfo:
-			infoData = ad.Bytes()
-		case inetDiagVegasInfo:
-			vi := &VegasInfo{}
-			err := unmarshalStruct(ad.Bytes(), vi)
-			multiError = errors.Join(multiError, err)
-			info.VegasInfo = vi
-		case inetDiagCong:
-			info.Cong = stringPtr(ad.String())
-		case inetDiagTOS:
-			info.TOS = uint8Ptr(ad.Uint8())
-		case inetDiagTClass:
-			info.TClass = uint8Ptr(ad.Uint8())
-		case inetDiagSKMemInfo:
-			si := &SkMemInfo{}
-			err := unmarshalStruct(ad.Bytes(), si)
-			multiError = errors.Join(multiError, err)
-			info.SkMemInfo = si
-		case inetDiagShutdown:
-			info.Shutdown = uint8Ptr(ad.Uint8())
-		case inetDiagDCTCPInfo:
-			di := &DCTCPInfo{}
-			err := unmarshalStruct(ad.Bytes(), di)
-			multiError = errors.Join(multiError, err)
-			info.DCTCPInfo = di
-		case inetDiagProtocol:
-			info.Protocol = uint8Ptr(ad.Uint8())
-		case inetDiagSKV6Only:
-			info.SKV6Only = uint8Ptr(ad.Uint8())
-		// case inetDiagLocals:
-		// case inetDiagPeers:
-		case inetDiagPad:
-			// nothing to do here.
-			continue
-		case inetDiagMark:
-			info.Mark = uint32Ptr(ad.Uint32())
-		case inetDiagBBRInfo:
-			bbrInfo := &BBRInfo{}
-			err := unmarshalStruct(ad.Bytes(), bbrInfo)
-			multiError = errors.Join(multiError, err)
-			info.BBRInfo = bbrInfo
-		case inetDiagClassID:
-			info.ClassID = uint32Ptr(ad.Uint32())
-		// case inetDiagMD5Sig:
-		// case inetDiagULPInfo:
-		// case inetDiagSKBpfStorages:
-		case inetDiagCGroupID:
-			info.CGroupID = uint64Ptr(ad.Uint64())
-		case inetDiagSockOpt:
-			so := &SockOpt{}
-			err := unmarshalStruct(ad.Bytes(), so)
-			multiError = errors.Join(multiError, err)
-			info.SockOpt = so
-		default:
-			multiError = errors.Join(multiError, fmt.Errorf("net type %d not implemented", adType))
-		}
-	}
-	if err := errors.Join(multiError, ad.Err()); err != nil {
-		return err
-	}
-
-	parseTcpInfo := func() {
-		tcpInfo := &TcpInfo{}
-		data := make([]byte, binary.Size(tcpInfo))
-		copy(data, infoData)
-		err := unmarshalStruct(data, tcpInfo)
-		multiError = errors.Join(multiError, err)
-		info.TcpInfo = tcpInfo
-	}
-
-	if len(infoData) != 0 {
-		// When asking for a specific socket, no INET_DIAG_PROTOCOL attribute
-		// is returned...
-		if info.Protocol == nil {
-			parseTcpInfo()
-		} else {
-			switch uint16(*info.Protocol) {
-			case unix.IPPROTO_TCP:
-				parseTcpInfo()
-			case unix.IPPROTO_SCTP:
-				sctpInfo := &SctpInfo{}
-				data := make([]byte, binary.Size(sctpInfo))
-				copy(data, infoData)
-				err := unmarshalStruct(data, sctpInfo)
-				multiError = errors.Join(multiError, err)
-				info.SctpInfo = sctpInfo
-			default:
-				multiError = errors.Join(multiError, fmt.Errorf("unhandled IPPROTO (%d) for INET_DIAG_INFO",
-					*info.Protocol))
-			}
-		}
-	}
-
-	return multiError
+	return msgs, nil
 }
 
-func (d *Diag) dumpQuery(header interface{}) ([]netlink.Message, error) {
+func (d *Diag) dumpQuery(header interface{}, attrs []byte) ([]netlink.Message, error) {
 	tcminfo, err := marshalStruct(header)
 	if err != nil {
 		return nil, err
@@ -191,6 +124,7 @@ func (d *Diag) dumpQuery(header interface{}) ([]netlink.Message, error) {
 
 	data := []byte{}
 	data = append(data, tcminfo...)
+	data = append(data, attrs...)
 
 	req := netlink.Message{
 		Header: netlink.Header{
@@ -204,42 +138,57 @@ func (d *Diag) dumpQuery(header interface{}) ([]netlink.Message, error) {
 	return d.query(req)
 }
 
-func handleNetResponse(msgs []netlink.Message, skipOptional bool) ([]NetObject, error) {
-	var results []NetObject
-	sizeOfRecvMsg := binary.Size(DiagMsg{})
-
-	for _, msg := range msgs {
+func handleNetResponse(msgs []netlink.Message, opts decodeOptions) ([]NetObject, error) {
+	results := make([]NetObject, 0, len(msgs))
+	for i, msg := range msgs {
 		var result NetObject
-		if err := unmarshalStruct(msg.Data[:sizeOfRecvMsg], &result.DiagMsg); err != nil {
-			return nil, err
-		}
-		if skipOptional {
-			continue
-		}
-		if err := extractAttributes(msg.Data[sizeOfRecvMsg:], &result.NetAttribute); err != nil {
-			return nil, err
+		opts.index = i
+		if err := decodeNetMessage(msg.Data, &result, opts); err != nil {
+			return nil, withIndex(err, i)
 		}
 		results = append(results, result)
 	}
 	return results, nil
 }
 
-func handleUnixResponse(msgs []netlink.Message, skipOptional bool) ([]UnixObject, error) {
-	var results []UnixObject
-	sizeOfRecvMsg := binary.Size(UnixDiagMsg{})
+// decodeNetMessage decodes a single inet_diag_msg and its attributes.
+func decodeNetMessage(data []byte, result *NetObject, opts decodeOptions) error {
+	if err := decodeNetHeader(data, &result.DiagMsg); err != nil || opts.skipOptional {
+		return err
+	}
+	var values netValues
+	err := values.decode(data[sizeOfDiagMsg:], &result.NetAttribute, opts)
+	values.copyTo(&result.NetAttribute)
+	return err
+}
+
+func decodeNetHeader(data []byte, msg *DiagMsg) error {
+	if len(data) < sizeOfDiagMsg {
+		return &DecodeError{Attribute: -1, Data: data, Err: io.ErrUnexpectedEOF}
+	}
+	return msg.decode(data[:sizeOfDiagMsg])
+}
 
-	for _, msg := range msgs {
+func handleUnixResponse(msgs []netlink.Message, opts decodeOptions) ([]UnixObject, error) {
+	results := make([]UnixObject, 0, len(msgs))
+	for i, msg := range msgs {
 		var result UnixObject
-		if err := unmarshalStruct(msg.Data[:sizeOfRecvMsg], &result.UnixDiagMsg); err != nil {
-			return nil, err
-		}
-		if skipOptional {
-			continue
-		}
-		if err := extractUnixAttributes(msg.Data[sizeOfRecvMsg:], &result.UnixAttribute); err != nil {
-			return nil, err
+		opts.index = i
+		if err := decodeUnixMessage(msg.Data, &result, opts); err != nil {
+			return nil, withIndex(err, i)
 		}
 		results = append(results, result)
 	}
 	return results, nil
 }
+
+// decodeUnixMessage decodes a single unix_diag_msg and its attributes.
+func decodeUnixMessage(data []byte, result *UnixObject, opts decodeOptions) error {
+	if len(data) < sizeOfUnixDiagMsg {
+		return &DecodeError{Attribute: -1, Data: data, Err: io.ErrUnexpectedEOF}
+	}
+	if err := result.UnixDiagMsg.decode(data[:sizeOfUnixDiagMsg]); err != nil || opts.skipOptional {
+		return err
+	}
+	return extractUnixAttributes(data[sizeOfUnixDiagMsg:], &result.UnixAttribute, opts)
+}
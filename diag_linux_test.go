@@ -151,3 +151,25 @@ func TestDiagUDP(t *testing.T) {
 		})
 	}
 }
+
+func TestDiagSummary(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	nl, err := Open(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nl.Close()
+
+	s, err := nl.Summary(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ByState["tcp"][StateListen] == 0 {
+		t.Fatalf("expected a listening TCP socket, got %v", s.ByState)
+	}
+}
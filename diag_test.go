@@ -0,0 +1,142 @@
+package diag
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+)
+
+func buildNetMessage(t *testing.T, msg DiagMsg, encode func(ae *netlink.AttributeEncoder)) netlink.Message {
+	t.Helper()
+	data, err := marshalStruct(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ae := netlink.NewAttributeEncoder()
+	encode(ae)
+	attrs, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return netlink.Message{Data: append(data, attrs...)}
+}
+
+func TestHandleNetResponse(t *testing.T) {
+	msgs := []netlink.Message{
+		buildNetMessage(t, DiagMsg{Family: 2, INode: 42}, func(ae *netlink.AttributeEncoder) {
+			ae.Uint8(inetDiagProtocol, 6)
+			ae.Uint32(inetDiagMark, 0xAB)
+			ae.String(inetDiagCong, "cubic")
+		}),
+	}
+
+	tests := map[string]struct {
+		opts  decodeOptions
+		check func(t *testing.T, obj NetObject)
+	}{
+		"all": {
+			check: func(t *testing.T, obj NetObject) {
+				if obj.Mark == nil || *obj.Mark != 0xAB {
+					t.Fatalf("expected mark 0xAB")
+				}
+				if obj.Cong == nil || *obj.Cong != "cubic" {
+					t.Fatalf("expected congestion control cubic")
+				}
+			},
+		},
+		"skipOptional": {
+			opts: decodeOptions{skipOptional: true},
+			check: func(t *testing.T, obj NetObject) {
+				if obj.Mark != nil || obj.Cong != nil || obj.Protocol != nil {
+					t.Fatalf("expected no attributes to be decoded")
+				}
+			},
+		},
+		"selected": {
+			opts: decodeOptions{netAttrs: NetAttrMark},
+			check: func(t *testing.T, obj NetObject) {
+				if obj.Mark == nil || *obj.Mark != 0xAB {
+					t.Fatalf("expected mark 0xAB")
+				}
+				if obj.Cong != nil || obj.Protocol != nil {
+					t.Fatalf("expected only mark to be decoded")
+				}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			objs, err := handleNetResponse(msgs, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objs) != 1 {
+				t.Fatalf("expected 1 object, got %d", len(objs))
+			}
+			if objs[0].INode != 42 {
+				t.Fatalf("expected inode 42, got %d", objs[0].INode)
+			}
+			test.check(t, objs[0])
+		})
+	}
+}
+
+func TestHandleNetResponseLenient(t *testing.T) {
+	msgs := []netlink.Message{
+		buildNetMessage(t, DiagMsg{Family: 2}, func(ae *netlink.AttributeEncoder) {}),
+		buildNetMessage(t, DiagMsg{Family: 2}, func(ae *netlink.AttributeEncoder) {
+			ae.Uint32(inetDiagMark, 0xAB)
+			ae.Bytes(200, []byte{0xDE, 0xAD, 0xBE, 0xEF})
+		}),
+	}
+
+	if _, err := handleNetResponse(msgs, decodeOptions{}); err == nil {
+		t.Fatalf("expected error for unknown attribute")
+	}
+
+	var warnings []error
+	objs, err := handleNetResponse(msgs, decodeOptions{
+		lenient:   true,
+		onWarning: func(err error) { warnings = append(warnings, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d", len(warnings))
+	}
+	var de *DecodeError
+	if !errors.As(warnings[0], &de) || de.Index != 1 || de.Attribute != 200 {
+		t.Fatalf("expected warning for attribute 200 of message 1, got %v", warnings[0])
+	}
+	if objs[1].Mark == nil || *objs[1].Mark != 0xAB {
+		t.Fatalf("expected mark 0xAB")
+	}
+	unknown := objs[1].Unknown
+	if len(unknown) != 1 || unknown[0].Type != 200 || len(unknown[0].Data) != 4 {
+		t.Fatalf("unexpected unknown attributes: %v", unknown)
+	}
+}
+
+func TestExtractUnixIcons(t *testing.T) {
+	// The kernel reports the inodes of unix_diag icons in host byte order.
+	var icons []byte
+	icons = nativeEndian.AppendUint32(icons, 0x01020304)
+	icons = nativeEndian.AppendUint32(icons, 7)
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(unixDiagIcons, icons)
+	data, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info UnixAttribute
+	if err := extractUnixAttributes(data, &info, decodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Icons) != 2 || info.Icons[0] != 0x01020304 || info.Icons[1] != 7 {
+		t.Fatalf("unexpected icons %v", info.Icons)
+	}
+}
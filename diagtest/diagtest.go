@@ -0,0 +1,120 @@
+// Package diagtest provides a fake sock_diag connection for tests of code,
+// that uses the package diag. It requires neither privileges nor a kernel
+// with sock_diag support.
+//
+// A Server answers the requests of a diag.Diag with scripted replies, whose
+// payloads can be built with NetMessage and UnixMessage:
+//
+//	srv := diagtest.NewServer(diagtest.Reply{
+//		Payloads: [][]byte{
+//			diagtest.NetMessage(diag.DiagMsg{Family: unix.AF_INET},
+//				diagtest.Cong("cubic")),
+//		},
+//	})
+//	d, err := srv.Open(nil)
+package diagtest
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+
+	"github.com/florianl/go-diag"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nltest"
+)
+
+// sockDiagByFamily is the message type SOCK_DIAG_BY_FAMILY.
+const sockDiagByFamily = 20
+
+// ErrNoReply is returned for requests, if all replies are used up.
+var ErrNoReply = errors.New("diagtest: no reply left")
+
+// Reply is the answer to a single request.
+type Reply struct {
+	// Payloads are returned as a multi-part reply, one netlink message
+	// per payload.
+	Payloads [][]byte
+
+	// Errno is returned as netlink error instead of Payloads, if set.
+	Errno syscall.Errno
+}
+
+// Server serves scripted replies to the requests of a diag.Diag. It is safe
+// for concurrent use.
+type Server struct {
+	mu       sync.Mutex
+	replies  []Reply
+	requests []netlink.Message
+}
+
+// NewServer returns a Server that answers requests in order with replies.
+func NewServer(replies ...Reply) *Server {
+	return &Server{replies: replies}
+}
+
+// Enqueue adds replies for further requests.
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []netlink.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]netlink.Message(nil), s.requests...)
+}
+
+// Open returns a diag.Diag that sends its requests to s. The options
+// ExtendedAcknowledge and StrictCheck of config are ignored.
+func (s *Server) Open(config *diag.Config) (*diag.Diag, error) {
+	var cfg diag.Config
+	if config != nil {
+		cfg = *config
+	}
+	cfg.ExtendedAcknowledge = false
+	cfg.StrictCheck = false
+	return diag.OpenConn(nltest.Dial(s.serve), &cfg)
+}
+
+func (s *Server) serve(reqs []netlink.Message) ([]netlink.Message, error) {
+	if len(reqs) == 0 {
+		// Receive without a request.
+		return nil, io.EOF
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, reqs...)
+	if len(s.replies) == 0 {
+		return nil, ErrNoReply
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+
+	if reply.Errno != 0 {
+		// nltest.Error keeps the flags of the request, but the dump flags
+		// are read as NLM_F_CAPPED and NLM_F_ACK_TLVS in error messages.
+		req := reqs[0]
+		req.Header.Flags = netlink.Request
+		return nltest.Error(int(reply.Errno), []netlink.Message{req})
+	}
+	if len(reply.Payloads) == 0 {
+		return nil, io.EOF
+	}
+	header := netlink.Header{
+		Type:     sockDiagByFamily,
+		Sequence: reqs[0].Header.Sequence,
+		PID:      reqs[0].Header.PID,
+	}
+	msgs := make([]netlink.Message, 0, len(reply.Payloads)+1)
+	for _, payload := range reply.Payloads {
+		msgs = append(msgs, netlink.Message{Header: header, Data: payload})
+	}
+	// The final message is turned into NLMSG_DONE by Multipart.
+	msgs = append(msgs, netlink.Message{Header: header, Data: make([]byte, 4)})
+	return nltest.Multipart(msgs)
+}
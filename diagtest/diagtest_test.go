@@ -0,0 +1,73 @@
+package diagtest
+
+import (
+	"errors"
+	"net/netip"
+	"syscall"
+	"testing"
+
+	"github.com/florianl/go-diag"
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestServer(t *testing.T) {
+	id := diag.NewSockID(netip.MustParseAddrPort("10.0.0.1:443"),
+		netip.MustParseAddrPort("192.0.2.1:50000"))
+	srv := NewServer(
+		Reply{Payloads: [][]byte{
+			NetMessage(diag.DiagMsg{Family: unix.AF_INET, State: uint8(diag.StateEstablished), ID: id},
+				Cong("bbr"), Mark(42), TcpInfo(diag.TcpInfo{Rtt: 1000}), Protocol(unix.IPPROTO_TCP)),
+			NetObject(diag.NetObject{DiagMsg: diag.DiagMsg{Family: unix.AF_INET, State: uint8(diag.StateListen)}}),
+		}},
+		Reply{},
+		Reply{Payloads: [][]byte{
+			UnixMessage(diag.UnixDiagMsg{Family: unix.AF_UNIX, Type: unix.SOCK_STREAM, Ino: 7},
+				UnixName("\x00abstract"), UnixPeer(8), UnixIcons(9, 10), UnixUID(1000)),
+		}},
+		Reply{Errno: syscall.ENOENT},
+	)
+	d, err := srv.Open(&diag.Config{ExtendedAcknowledge: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	objs, err := d.TCPDump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 sockets, got %d", len(objs))
+	}
+	obj := objs[0]
+	if obj.ID.Local(obj.Family).String() != "10.0.0.1:443" || obj.SockState() != diag.StateEstablished {
+		t.Errorf("unexpected socket %+v", obj.DiagMsg)
+	}
+	if obj.Cong == nil || *obj.Cong != "bbr" || obj.Mark == nil || *obj.Mark != 42 ||
+		obj.TcpInfo == nil || obj.TcpInfo.Rtt != 1000 {
+		t.Errorf("unexpected attributes %+v", obj.NetAttribute)
+	}
+
+	uobjs, err := d.UnixDump(&diag.UnixOption{State: diag.AllStates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uobjs) != 1 {
+		t.Fatalf("expected 1 socket, got %d", len(uobjs))
+	}
+	u := uobjs[0]
+	if u.Name == nil || *u.Name != "\x00abstract" || u.Peer == nil || *u.Peer != 8 ||
+		len(u.Icons) != 2 || u.UID == nil || *u.UID != 1000 {
+		t.Errorf("unexpected attributes %+v", u.UnixAttribute)
+	}
+
+	if _, err := d.UnixDump(&diag.UnixOption{}); !errors.Is(err, diag.ErrNotFound) {
+		t.Errorf("expected %v, got %v", diag.ErrNotFound, err)
+	}
+	if _, err := d.UnixDump(&diag.UnixOption{}); !errors.Is(err, ErrNoReply) {
+		t.Errorf("expected %v, got %v", ErrNoReply, err)
+	}
+	if n := len(srv.Requests()); n != 5 {
+		t.Errorf("expected 5 requests, got %d", n)
+	}
+}
@@ -0,0 +1,204 @@
+package diagtest
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/florianl/go-diag"
+	"github.com/mdlayher/netlink"
+)
+
+// Based on the INET_DIAG_* attributes in include/uapi/linux/inet_diag.h
+const (
+	inetDiagMemInfo   = 1
+	inetDiagInfo      = 2
+	inetDiagVegasInfo = 3
+	inetDiagCong      = 4
+	inetDiagTOS       = 5
+	inetDiagTClass    = 6
+	inetDiagSKMemInfo = 7
+	inetDiagShutdown  = 8
+	inetDiagDCTCPInfo = 9
+	inetDiagProtocol  = 10
+	inetDiagSKV6Only  = 11
+	inetDiagMark      = 15
+	inetDiagBBRInfo   = 16
+	inetDiagClassID   = 17
+	inetDiagCGroupID  = 21
+	inetDiagSockOpt   = 22
+)
+
+// Based on the UNIX_DIAG_* attributes in include/uapi/linux/unix_diag.h
+const (
+	unixDiagName     = 0
+	unixDiagVFS      = 1
+	unixDiagPeer     = 2
+	unixDiagIcons    = 3
+	unixDiagRQLen    = 4
+	unixDiagMemInfo  = 5
+	unixDiagShutdown = 6
+	unixDiagUID      = 7
+)
+
+// marshal returns the encoding of the fixed size value v in native endian.
+func marshal(v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.NativeEndian, v); err != nil {
+		panic("diagtest: " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+func message(header interface{}, attrs []netlink.Attribute) []byte {
+	data := marshal(header)
+	if len(attrs) == 0 {
+		return data
+	}
+	encoded, err := netlink.MarshalAttributes(attrs)
+	if err != nil {
+		panic("diagtest: " + err.Error())
+	}
+	return append(data, encoded...)
+}
+
+// NetMessage returns the payload of an inet_diag_msg with attrs.
+func NetMessage(msg diag.DiagMsg, attrs ...netlink.Attribute) []byte {
+	return message(msg, attrs)
+}
+
+// UnixMessage returns the payload of an unix_diag_msg with attrs.
+func UnixMessage(msg diag.UnixDiagMsg, attrs ...netlink.Attribute) []byte {
+	return message(msg, attrs)
+}
+
+// NetObject returns the payload of obj, as it is sent by the kernel.
+func NetObject(obj diag.NetObject) []byte {
+	data, err := obj.MarshalBinary()
+	if err != nil {
+		panic("diagtest: " + err.Error())
+	}
+	return data
+}
+
+// UnixObject returns the payload of obj, as it is sent by the kernel.
+func UnixObject(obj diag.UnixObject) []byte {
+	data, err := obj.MarshalBinary()
+	if err != nil {
+		panic("diagtest: " + err.Error())
+	}
+	return data
+}
+
+func uint8Attr(typ uint16, v uint8) netlink.Attribute {
+	return netlink.Attribute{Type: typ, Data: []byte{v}}
+}
+
+func uint32Attr(typ uint16, v uint32) netlink.Attribute {
+	return netlink.Attribute{Type: typ, Data: binary.NativeEndian.AppendUint32(nil, v)}
+}
+
+func uint64Attr(typ uint16, v uint64) netlink.Attribute {
+	return netlink.Attribute{Type: typ, Data: binary.NativeEndian.AppendUint64(nil, v)}
+}
+
+func structAttr(typ uint16, v interface{}) netlink.Attribute {
+	return netlink.Attribute{Type: typ, Data: marshal(v)}
+}
+
+// MemInfo returns the attribute INET_DIAG_MEMINFO.
+func MemInfo(m diag.MemInfo) netlink.Attribute { return structAttr(inetDiagMemInfo, m) }
+
+// TcpInfo returns the attribute INET_DIAG_INFO of a TCP socket.
+func TcpInfo(info diag.TcpInfo) netlink.Attribute { return structAttr(inetDiagInfo, info) }
+
+// SctpInfo returns the attribute INET_DIAG_INFO of a SCTP socket.
+func SctpInfo(info diag.SctpInfo) netlink.Attribute { return structAttr(inetDiagInfo, info) }
+
+// VegasInfo returns the attribute INET_DIAG_VEGASINFO.
+func VegasInfo(info diag.VegasInfo) netlink.Attribute { return structAttr(inetDiagVegasInfo, info) }
+
+// Cong returns the attribute INET_DIAG_CONG.
+func Cong(name string) netlink.Attribute {
+	return netlink.Attribute{Type: inetDiagCong, Data: append([]byte(name), 0)}
+}
+
+// TOS returns the attribute INET_DIAG_TOS.
+func TOS(tos uint8) netlink.Attribute { return uint8Attr(inetDiagTOS, tos) }
+
+// TClass returns the attribute INET_DIAG_TCLASS.
+func TClass(tclass uint8) netlink.Attribute { return uint8Attr(inetDiagTClass, tclass) }
+
+// SkMemInfo returns the attribute INET_DIAG_SKMEMINFO.
+func SkMemInfo(m diag.SkMemInfo) netlink.Attribute { return structAttr(inetDiagSKMemInfo, m) }
+
+// Shutdown returns the attribute INET_DIAG_SHUTDOWN.
+func Shutdown(mode diag.ShutdownMode) netlink.Attribute {
+	return uint8Attr(inetDiagShutdown, uint8(mode))
+}
+
+// DCTCPInfo returns the attribute INET_DIAG_DCTCPINFO.
+func DCTCPInfo(info diag.DCTCPInfo) netlink.Attribute { return structAttr(inetDiagDCTCPInfo, info) }
+
+// Protocol returns the attribute INET_DIAG_PROTOCOL.
+func Protocol(protocol uint8) netlink.Attribute { return uint8Attr(inetDiagProtocol, protocol) }
+
+// V6Only returns the attribute INET_DIAG_SKV6ONLY.
+func V6Only(v6only bool) netlink.Attribute {
+	var v uint8
+	if v6only {
+		v = 1
+	}
+	return uint8Attr(inetDiagSKV6Only, v)
+}
+
+// Mark returns the attribute INET_DIAG_MARK.
+func Mark(mark uint32) netlink.Attribute { return uint32Attr(inetDiagMark, mark) }
+
+// BBRInfo returns the attribute INET_DIAG_BBRINFO.
+func BBRInfo(info diag.BBRInfo) netlink.Attribute { return structAttr(inetDiagBBRInfo, info) }
+
+// ClassID returns the attribute INET_DIAG_CLASS_ID.
+func ClassID(id uint32) netlink.Attribute { return uint32Attr(inetDiagClassID, id) }
+
+// CGroupID returns the attribute INET_DIAG_CGROUP_ID.
+func CGroupID(id uint64) netlink.Attribute { return uint64Attr(inetDiagCGroupID, id) }
+
+// SockOpt returns the attribute INET_DIAG_SOCKOPT.
+func SockOpt(opt diag.SockOpt) netlink.Attribute { return structAttr(inetDiagSockOpt, opt) }
+
+// UnixName returns the attribute UNIX_DIAG_NAME. Abstract names start
+// with a null byte.
+func UnixName(name string) netlink.Attribute {
+	return netlink.Attribute{Type: unixDiagName, Data: []byte(name)}
+}
+
+// UnixVfs returns the attribute UNIX_DIAG_VFS.
+func UnixVfs(vfs diag.UnixDiagVfs) netlink.Attribute { return structAttr(unixDiagVFS, vfs) }
+
+// UnixPeer returns the attribute UNIX_DIAG_PEER.
+func UnixPeer(ino uint32) netlink.Attribute { return uint32Attr(unixDiagPeer, ino) }
+
+// UnixIcons returns the attribute UNIX_DIAG_ICONS.
+func UnixIcons(inos ...uint32) netlink.Attribute {
+	data := make([]byte, 0, 4*len(inos))
+	for _, ino := range inos {
+		data = binary.NativeEndian.AppendUint32(data, ino)
+	}
+	return netlink.Attribute{Type: unixDiagIcons, Data: data}
+}
+
+// UnixRQLen returns the attribute UNIX_DIAG_RQLEN.
+func UnixRQLen(rqlen diag.UnixDiagRqLen) netlink.Attribute {
+	return structAttr(unixDiagRQLen, rqlen)
+}
+
+// UnixMemInfo returns the attribute UNIX_DIAG_MEMINFO.
+func UnixMemInfo(m diag.MemInfo) netlink.Attribute { return structAttr(unixDiagMemInfo, m) }
+
+// UnixShutdown returns the attribute UNIX_DIAG_SHUTDOWN.
+func UnixShutdown(mode diag.ShutdownMode) netlink.Attribute {
+	return uint8Attr(unixDiagShutdown, uint8(mode))
+}
+
+// UnixUID returns the attribute UNIX_DIAG_UID.
+func UnixUID(uid uint32) netlink.Attribute { return uint32Attr(unixDiagUID, uid) }
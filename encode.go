@@ -0,0 +1,182 @@
+package diag
+
+import (
+	"github.com/mdlayher/netlink"
+)
+
+// structEncoder encodes structs as attributes and keeps the first error.
+type structEncoder struct {
+	ae  *netlink.AttributeEncoder
+	err error
+}
+
+func (e *structEncoder) put(attrType uint16, s interface{}) {
+	if e.err != nil {
+		return
+	}
+	var data []byte
+	data, e.err = marshalStruct(s)
+	e.ae.Bytes(attrType, data)
+}
+
+func encodeNetAttributes(info *NetAttribute) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	se := &structEncoder{ae: ae}
+	if info.MemInfo != nil {
+		se.put(inetDiagMemInfo, info.MemInfo)
+	}
+	if info.VegasInfo != nil {
+		se.put(inetDiagVegasInfo, info.VegasInfo)
+	}
+	if info.SkMemInfo != nil {
+		se.put(inetDiagSKMemInfo, info.SkMemInfo)
+	}
+	if info.DCTCPInfo != nil {
+		se.put(inetDiagDCTCPInfo, info.DCTCPInfo)
+	}
+	if info.BBRInfo != nil {
+		se.put(inetDiagBBRInfo, info.BBRInfo)
+	}
+	if info.SockOpt != nil {
+		se.put(inetDiagSockOpt, info.SockOpt)
+	}
+	if se.err != nil {
+		return nil, se.err
+	}
+
+	var infoData []byte
+	var err error
+	switch {
+	case info.TcpInfo != nil:
+		infoData, err = marshalStruct(info.TcpInfo)
+	case info.SctpInfo != nil:
+		infoData, err = marshalStruct(info.SctpInfo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if infoData != nil {
+		// Older kernels report a shorter INET_DIAG_INFO.
+		if info.InfoLen > 0 && info.InfoLen < len(infoData) {
+			infoData = infoData[:info.InfoLen]
+		}
+		ae.Bytes(inetDiagInfo, infoData)
+	}
+
+	if info.Cong != nil {
+		ae.String(inetDiagCong, *info.Cong)
+	}
+	for _, attr := range []struct {
+		attrType uint16
+		v        *uint8
+	}{
+		{inetDiagTOS, info.TOS},
+		{inetDiagTClass, info.TClass},
+		{inetDiagShutdown, info.Shutdown},
+		{inetDiagProtocol, info.Protocol},
+		{inetDiagSKV6Only, info.SKV6Only},
+	} {
+		if attr.v != nil {
+			ae.Uint8(attr.attrType, *attr.v)
+		}
+	}
+	if info.Mark != nil {
+		ae.Uint32(inetDiagMark, *info.Mark)
+	}
+	if info.ClassID != nil {
+		ae.Uint32(inetDiagClassID, *info.ClassID)
+	}
+	if info.CGroupID != nil {
+		ae.Uint64(inetDiagCGroupID, *info.CGroupID)
+	}
+	for _, raw := range info.Unknown {
+		ae.Bytes(raw.Type, raw.Data)
+	}
+	return ae.Encode()
+}
+
+// MarshalBinary encodes o as inet_diag_msg followed by its attributes, as
+// they are sent by the kernel. It implements encoding.BinaryMarshaler.
+// SctpInfo is only decoded again, if Protocol is set to IPPROTO_SCTP.
+func (o *NetObject) MarshalBinary() ([]byte, error) {
+	data, err := marshalStruct(o.DiagMsg)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := encodeNetAttributes(&o.NetAttribute)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, attrs...), nil
+}
+
+// UnmarshalBinary decodes an inet_diag_msg with its attributes like
+// NetDump. Unknown attributes are kept in Unknown. It implements
+// encoding.BinaryUnmarshaler.
+func (o *NetObject) UnmarshalBinary(data []byte) error {
+	*o = NetObject{}
+	return decodeNetMessage(data, o, decodeOptions{lenient: true})
+}
+
+func encodeUnixAttributes(info *UnixAttribute) ([]byte, error) {
+	ae := netlink.NewAttributeEncoder()
+	if info.Name != nil {
+		// Names are not null-terminated.
+		ae.Bytes(unixDiagName, []byte(*info.Name))
+	}
+	se := &structEncoder{ae: ae}
+	if info.Vfs != nil {
+		se.put(unixDiagVFS, info.Vfs)
+	}
+	if info.RQLen != nil {
+		se.put(unixDiagRQLen, info.RQLen)
+	}
+	if info.MemInfo != nil {
+		se.put(unixDiagMemInfo, info.MemInfo)
+	}
+	if se.err != nil {
+		return nil, se.err
+	}
+	if info.Peer != nil {
+		ae.Uint32(unixDiagPeer, *info.Peer)
+	}
+	if info.Icons != nil {
+		icons := make([]byte, 0, 4*len(info.Icons))
+		for _, ino := range info.Icons {
+			icons = nativeEndian.AppendUint32(icons, ino)
+		}
+		ae.Bytes(unixDiagIcons, icons)
+	}
+	if info.Shutdown != nil {
+		ae.Uint8(unixDiagShutdown, *info.Shutdown)
+	}
+	if info.UID != nil {
+		ae.Uint32(unixDiagUID, *info.UID)
+	}
+	for _, raw := range info.Unknown {
+		ae.Bytes(raw.Type, raw.Data)
+	}
+	return ae.Encode()
+}
+
+// MarshalBinary encodes o as unix_diag_msg followed by its attributes, as
+// they are sent by the kernel. It implements encoding.BinaryMarshaler.
+func (o *UnixObject) MarshalBinary() ([]byte, error) {
+	data, err := marshalStruct(o.UnixDiagMsg)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := encodeUnixAttributes(&o.UnixAttribute)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, attrs...), nil
+}
+
+// UnmarshalBinary decodes an unix_diag_msg with its attributes like
+// UnixDump. Unknown attributes are kept in Unknown. It implements
+// encoding.BinaryUnmarshaler.
+func (o *UnixObject) UnmarshalBinary(data []byte) error {
+	*o = UnixObject{}
+	return decodeUnixMessage(data, o, decodeOptions{lenient: true})
+}
@@ -0,0 +1,114 @@
+package diag
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestNetObjectRoundTrip(t *testing.T) {
+	cong := "bbr"
+	tcp := uint8(unix.IPPROTO_TCP)
+	sctp := uint8(unix.IPPROTO_SCTP)
+	tos, tclass, shutdown, v6only := uint8(0x10), uint8(0x20), uint8(ShutdownSend), uint8(1)
+	mark, classID, cgroupID := uint32(42), uint32(0x10001), uint64(1234)
+	id := NewSockID(netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("[2001:db8::2]:50000"))
+
+	tests := map[string]NetObject{
+		"tcp": {
+			DiagMsg: DiagMsg{Family: unix.AF_INET6, State: uint8(StateEstablished), ID: id,
+				Expires: 200, RQueue: 1, WQueue: 2, UID: 1000, INode: 4711},
+			NetAttribute: NetAttribute{
+				MemInfo:   &MemInfo{RMem: 1, WMem: 2, FMem: 3, TMem: 4},
+				VegasInfo: &VegasInfo{Enabled: 1, Rtt: 3},
+				Cong:      &cong,
+				TOS:       &tos,
+				TClass:    &tclass,
+				Shutdown:  &shutdown,
+				SkMemInfo: &SkMemInfo{RMemAlloc: 1, Drops: 9},
+				DCTCPInfo: &DCTCPInfo{Enabeld: 1, Alpha: 7},
+				Protocol:  &tcp,
+				SKV6Only:  &v6only,
+				Mark:      &mark,
+				BBRInfo:   &BBRInfo{BwLo: 1, BwHi: 2, MinRTT: 3},
+				ClassID:   &classID,
+				CGroupID:  &cgroupID,
+				SockOpt:   &SockOpt{Bitfield1: 0x24},
+				TcpInfo:   &TcpInfo{State: uint8(StateEstablished), Rtt: 1000, BytesAcked: 1 << 40},
+				InfoLen:   binary.Size(TcpInfo{}),
+				Unknown:   []RawAttribute{{Type: 99, Data: []byte{1, 2, 3, 4}}},
+			},
+		},
+		"tcp without protocol and short info": {
+			DiagMsg: DiagMsg{Family: unix.AF_INET},
+			NetAttribute: NetAttribute{
+				TcpInfo: &TcpInfo{Rtt: 1000},
+				InfoLen: 104,
+			},
+		},
+		"sctp": {
+			DiagMsg: DiagMsg{Family: unix.AF_INET},
+			NetAttribute: NetAttribute{
+				Protocol: &sctp,
+				SctpInfo: &SctpInfo{Tag: 1, State: 3},
+				InfoLen:  binary.Size(SctpInfo{}),
+			},
+		},
+		"no attributes": {
+			DiagMsg: DiagMsg{Family: unix.AF_INET, State: uint8(StateListen)},
+		},
+	}
+
+	for name, obj := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := obj.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got NetObject
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, obj) {
+				t.Fatalf("expected %+v, got %+v", obj.NetAttribute, got.NetAttribute)
+			}
+		})
+	}
+}
+
+func TestUnixObjectRoundTrip(t *testing.T) {
+	name := "\x00abstract"
+	peer, uid := uint32(8), uint32(1000)
+	shutdown := uint8(ShutdownRcv)
+	obj := UnixObject{
+		UnixDiagMsg: UnixDiagMsg{Family: unix.AF_UNIX, Type: unix.SOCK_STREAM,
+			State: uint8(StateListen), Ino: 7, Cookie: [2]uint32{1, 2}},
+		UnixAttribute: UnixAttribute{
+			Name:     &name,
+			Vfs:      &UnixDiagVfs{Ino: 1, Dev: 2},
+			RQLen:    &UnixDiagRqLen{RQueue: 3, WQueue: 4},
+			MemInfo:  &MemInfo{RMem: 5},
+			Shutdown: &shutdown,
+			UID:      &uid,
+			Peer:     &peer,
+			Icons:    []uint32{9, 10},
+			Unknown:  []RawAttribute{{Type: 99, Data: []byte{1, 2, 3, 4}}},
+		},
+	}
+
+	data, err := obj.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got UnixObject
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, obj) {
+		t.Fatalf("expected %+v, got %+v", obj.UnixAttribute, got.UnixAttribute)
+	}
+}
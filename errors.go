@@ -0,0 +1,149 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/mdlayher/netlink"
+)
+
+// Sentinel errors that can be checked with errors.Is.
+var (
+	// ErrNotFound is returned if the requested socket does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrNotSupported is returned if the kernel does not support the
+	// requested family or protocol. This includes dumps of protocols
+	// whose diag module, like sctp_diag or raw_diag, is not loaded, for
+	// which the kernel returns ENOENT.
+	ErrNotSupported = errors.New("not supported")
+	// ErrPermission is returned if the kernel denied the request.
+	ErrPermission = errors.New("permission denied")
+)
+
+// DecodeError is returned if a response of the kernel could not be decoded.
+type DecodeError struct {
+	// Attribute is the type of the netlink attribute that could not be
+	// decoded, or -1 if the error is not specific to a single attribute.
+	Attribute int
+	// Index is the position of the message within the dump.
+	Index int
+	// Data holds the raw bytes that could not be decoded.
+	Data []byte
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Attribute < 0 {
+		return fmt.Sprintf("message %d: decode: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("message %d: decode attribute %d: %v", e.Index, e.Attribute, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError returns err as *DecodeError for the attribute attrType.
+func decodeError(attrType int, data []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DecodeError{
+		Attribute: attrType,
+		Data:      data,
+		Err:       err,
+	}
+}
+
+// withIndex sets index on every *DecodeError in err.
+func withIndex(err error, index int) error {
+	switch e := err.(type) {
+	case *DecodeError:
+		e.Index = index
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			withIndex(err, index)
+		}
+	}
+	return err
+}
+
+// NetlinkError is returned if the kernel rejected a request.
+type NetlinkError struct {
+	// Op is the netlink operation that failed, such as "receive".
+	Op string
+	// Errno is the error number returned by the kernel.
+	Errno syscall.Errno
+	// Message and Offset contain the extended acknowledgement of the
+	// kernel, if Config.ExtendedAcknowledge is set. Offset is the byte
+	// offset of the offending attribute within the request, including
+	// the netlink header.
+	Message string
+	Offset  int
+	// Err is the underlying error.
+	Err error
+
+	// dump is set if the failed request was a dump request.
+	dump bool
+}
+
+func (e *NetlinkError) Error() string {
+	msg := fmt.Sprintf("netlink %s: %v", e.Op, e.Err)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Offset != 0 {
+		msg += fmt.Sprintf(" (offset %d)", e.Offset)
+	}
+	return msg
+}
+
+func (e *NetlinkError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows to check a NetlinkError against ErrNotFound, ErrNotSupported
+// and ErrPermission. ENOENT of a dump request means that no diag handler
+// is registered for the family and protocol, so it matches both
+// ErrNotFound and ErrNotSupported.
+func (e *NetlinkError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Errno == syscall.ENOENT
+	case ErrNotSupported:
+		return (e.dump && e.Errno == syscall.ENOENT) ||
+			e.Errno == syscall.EOPNOTSUPP ||
+			e.Errno == syscall.EAFNOSUPPORT ||
+			e.Errno == syscall.EPROTONOSUPPORT
+	case ErrPermission:
+		return e.Errno == syscall.EPERM || e.Errno == syscall.EACCES
+	}
+	return false
+}
+
+// netlinkError converts errors of the netlink package into *NetlinkError.
+func netlinkError(err error) error {
+	var opErr *netlink.OpError
+	if !errors.As(err, &opErr) {
+		return err
+	}
+	ne := &NetlinkError{
+		Op:      opErr.Op,
+		Message: opErr.Message,
+		Offset:  opErr.Offset,
+		Err:     opErr.Err,
+	}
+	errors.As(opErr.Err, &ne.Errno)
+	return ne
+}
+
+// dumpError is netlinkError for errors of dump requests.
+func dumpError(err error) error {
+	err = netlinkError(err)
+	if ne, ok := err.(*NetlinkError); ok {
+		ne.dump = true
+	}
+	return err
+}
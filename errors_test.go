@@ -0,0 +1,105 @@
+package diag
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nltest"
+)
+
+func TestNetlinkError(t *testing.T) {
+	err := netlinkError(&netlink.OpError{
+		Op:      "receive",
+		Err:     syscall.EACCES,
+		Message: "denied by policy",
+	})
+
+	var ne *NetlinkError
+	if !errors.As(err, &ne) {
+		t.Fatalf("expected *NetlinkError, got %T", err)
+	}
+	if ne.Errno != syscall.EACCES || ne.Message != "denied by policy" {
+		t.Fatalf("unexpected NetlinkError: %#v", ne)
+	}
+	if !errors.Is(err, ErrPermission) {
+		t.Fatalf("expected ErrPermission")
+	}
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrNotSupported) {
+		t.Fatalf("unexpected match of sentinel error")
+	}
+	if !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("expected errno to be unwrapped")
+	}
+}
+
+func TestNetlinkErrorNoDiagHandler(t *testing.T) {
+	con := nltest.Dial(func(reqs []netlink.Message) ([]netlink.Message, error) {
+		req := reqs[0]
+		req.Header.Flags = netlink.Request
+		return nltest.Error(int(syscall.ENOENT), []netlink.Message{req})
+	})
+	d, err := OpenConn(con, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// A dump of a protocol without diag module fails with ENOENT.
+	_, err = d.NetDump(&NetOption{Family: unix.AF_INET, Protocol: unix.IPPROTO_SCTP, State: AllStates})
+	if !errors.Is(err, ErrNotSupported) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotSupported and ErrNotFound, got %v", err)
+	}
+
+	// ENOENT of other requests means that the socket does not exist.
+	err = d.NetDestroy(&NetOption{Family: unix.AF_INET, Protocol: unix.IPPROTO_TCP})
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected only ErrNotFound, got %v", err)
+	}
+}
+
+func TestNetlinkErrorExtAck(t *testing.T) {
+	err := netlinkError(&netlink.OpError{
+		Op:      "receive",
+		Err:     syscall.EINVAL,
+		Message: "invalid bytecode",
+		Offset:  88,
+	})
+
+	expected := "netlink receive: invalid argument: invalid bytecode (offset 88)"
+	if got := err.Error(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	msgs := []netlink.Message{
+		buildNetMessage(t, DiagMsg{}, func(ae *netlink.AttributeEncoder) {}),
+		buildNetMessage(t, DiagMsg{}, func(ae *netlink.AttributeEncoder) {
+			ae.Bytes(inetDiagMemInfo, []byte{0x01, 0x02})
+		}),
+	}
+
+	_, err := handleNetResponse(msgs, decodeOptions{})
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected *DecodeError, got %v", err)
+	}
+	if de.Attribute != inetDiagMemInfo || de.Index != 1 || len(de.Data) != 2 {
+		t.Fatalf("unexpected DecodeError: %#v", de)
+	}
+}
+
+func TestDecodeErrorShortMessage(t *testing.T) {
+	msgs := []netlink.Message{{Data: make([]byte, 8)}}
+
+	if _, err := handleNetResponse(msgs, decodeOptions{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := handleUnixResponse(msgs, decodeOptions{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -33,10 +33,8 @@ func ExampleDiag() {
 	// Loop over TCP and UDP information for inet and inet6 sockets and print out
 	// source- and destination IP with the respective port information.
 	for _, socket := range append(tcpSockets, udpSockets...) {
-		src := diag.ToNetipAddr(socket.ID.Src)
-		srcPort := diag.Ntohs(socket.ID.SPort)
-		dst := diag.ToNetipAddr(socket.ID.Dst)
-		dstPort := diag.Ntohs(socket.ID.DPort)
-		fmt.Printf("%v:%d -> %v:%d\n", src, srcPort, dst, dstPort)
+		src := socket.ID.Local(socket.Family)
+		dst := socket.ID.Remote(socket.Family)
+		fmt.Printf("%v -> %v\n", src, dst)
 	}
 }
@@ -0,0 +1,455 @@
+// Package exporter provides socket metrics of the sock_diag subsystem in
+// the OpenMetrics text format, which is understood by Prometheus.
+//
+// The package has no dependencies beyond go-diag. An Exporter can be served
+// directly as scrape target:
+//
+//	d, err := diag.Open(&diag.Config{})
+//	if err != nil {
+//		// handle error
+//	}
+//	http.Handle("/metrics", exporter.New(d, nil))
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/florianl/go-diag"
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// ContentType is the content type of the OpenMetrics text format.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Dumper is the source of socket information. It is implemented by
+// *diag.Diag.
+type Dumper interface {
+	NetDump(opt *diag.NetOption) ([]diag.NetObject, error)
+	UnixDump(opt *diag.UnixOption) ([]diag.UnixObject, error)
+}
+
+// Source selects the sockets an Exporter reports on.
+type Source uint8
+
+// Sources of socket information.
+const (
+	SourceTCP Source = 1 << iota
+	SourceUDP
+	SourceUnix
+
+	SourceAll = SourceTCP | SourceUDP | SourceUnix
+)
+
+// DefaultRTTBuckets are the upper bounds in seconds of the buckets of the
+// RTT histogram.
+var DefaultRTTBuckets = []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// Config contains options for an Exporter.
+type Config struct {
+	// Namespace is the prefix of all metric names. It defaults to diag.
+	Namespace string
+
+	// Sources selects the sockets to report on. It defaults to SourceAll.
+	Sources Source
+
+	// RTTBuckets are the upper bounds in seconds of the buckets of the
+	// RTT histogram of TCP sockets. It defaults to DefaultRTTBuckets.
+	RTTBuckets []float64
+
+	// DisableRTTHistogram omits the RTT histogram. The retransmits of
+	// TCP sockets are reported anyway.
+	DisableRTTHistogram bool
+
+	// Ports adds the label port with the local port to the socket counts
+	// of TCP and UDP sockets. Sockets with a local port not in Ports
+	// are counted with port="other". Without Ports the label is omitted,
+	// which keeps the number of series independent of the workload.
+	Ports []uint16
+}
+
+// Exporter collects socket metrics on each scrape.
+type Exporter struct {
+	d   Dumper
+	cfg Config
+
+	// mu serializes scrapes, as Dumper is not required to be safe
+	// for concurrent use.
+	mu sync.Mutex
+}
+
+// New returns an Exporter that reads socket information from d.
+func New(d Dumper, config *Config) *Exporter {
+	e := &Exporter{d: d}
+	if config != nil {
+		e.cfg = *config
+	}
+	if e.cfg.Namespace == "" {
+		e.cfg.Namespace = "diag"
+	}
+	if e.cfg.Sources == 0 {
+		e.cfg.Sources = SourceAll
+	}
+	if e.cfg.RTTBuckets == nil {
+		e.cfg.RTTBuckets = DefaultRTTBuckets
+	}
+	e.cfg.RTTBuckets = slices.Clone(e.cfg.RTTBuckets)
+	sort.Float64s(e.cfg.RTTBuckets)
+	return e
+}
+
+// MetricType is the type of a metric family.
+type MetricType string
+
+// Metric types of the OpenMetrics format used by the Exporter.
+const (
+	Gauge     MetricType = "gauge"
+	Histogram MetricType = "histogram"
+)
+
+// Label is a label name and its value.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric family.
+type Sample struct {
+	// Suffix is appended to the name of the family, like _bucket for
+	// histograms.
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// MetricFamily is a set of samples with the same name and type.
+type MetricFamily struct {
+	Name    string
+	Type    MetricType
+	Help    string
+	Samples []Sample
+}
+
+type seriesKey struct {
+	protocol, state, port string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// collector aggregates the sockets of a single scrape.
+type collector struct {
+	cfg *Config
+
+	sockets map[seriesKey]uint64
+	recvQ   map[string]uint64
+	sendQ   map[string]uint64
+	drops   map[string]uint64
+	retrans uint64
+	rtt     histogram
+}
+
+// Collect queries the sockets and returns the metric families.
+func (e *Exporter) Collect() ([]MetricFamily, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c := &collector{
+		cfg:     &e.cfg,
+		sockets: make(map[seriesKey]uint64),
+		recvQ:   make(map[string]uint64),
+		sendQ:   make(map[string]uint64),
+		drops:   make(map[string]uint64),
+		rtt:     histogram{counts: make([]uint64, len(e.cfg.RTTBuckets))},
+	}
+
+	for _, src := range []struct {
+		source   Source
+		protocol uint8
+		name     string
+	}{
+		{SourceTCP, unix.IPPROTO_TCP, "tcp"},
+		{SourceUDP, unix.IPPROTO_UDP, "udp"},
+	} {
+		if e.cfg.Sources&src.source == 0 {
+			continue
+		}
+		opt := &diag.NetOption{
+			Protocol: src.protocol,
+			Ext:      diag.ExtSkMemInfo,
+			State:    diag.AllStates,
+		}
+		if src.protocol == unix.IPPROTO_TCP {
+			// TcpInfo holds the retransmits and the RTT.
+			opt.Ext |= diag.ExtInfo
+		}
+		for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+			opt.Family = family
+			objs, err := e.d.NetDump(opt)
+			if err != nil {
+				return nil, fmt.Errorf("%s dump: %w", src.name, err)
+			}
+			for i := range objs {
+				c.addNet(src.name, &objs[i])
+			}
+		}
+	}
+
+	if e.cfg.Sources&SourceUnix != 0 {
+		objs, err := e.d.UnixDump(&diag.UnixOption{
+			State: diag.AllStates,
+			Show:  diag.ShowRQLen,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unix dump: %w", err)
+		}
+		for i := range objs {
+			c.addUnix(&objs[i])
+		}
+	}
+
+	return c.families(), nil
+}
+
+func (c *collector) port(local uint16) string {
+	if len(c.cfg.Ports) == 0 {
+		return ""
+	}
+	if slices.Contains(c.cfg.Ports, local) {
+		return strconv.Itoa(int(local))
+	}
+	return "other"
+}
+
+func (c *collector) addNet(protocol string, obj *diag.NetObject) {
+	key := seriesKey{
+		protocol: protocol,
+		state:    obj.SockState().String(),
+		port:     c.port(diag.Ntohs(obj.ID.SPort)),
+	}
+	c.sockets[key]++
+	c.recvQ[protocol] += uint64(obj.RQueue)
+	c.sendQ[protocol] += uint64(obj.WQueue)
+	if obj.SkMemInfo != nil {
+		c.drops[protocol] += uint64(obj.SkMemInfo.Drops)
+	}
+	if obj.TcpInfo == nil {
+		return
+	}
+	c.retrans += uint64(obj.TcpInfo.RotalRetrans)
+	// Sockets without a measured RTT, like listening sockets or sockets
+	// in SYN-SENT, would skew the histogram.
+	if c.cfg.DisableRTTHistogram || obj.TcpInfo.Rtt == 0 {
+		return
+	}
+	rtt := obj.TcpInfo.RttDuration().Seconds()
+	c.rtt.count++
+	c.rtt.sum += rtt
+	for i, bound := range c.cfg.RTTBuckets {
+		if rtt <= bound {
+			c.rtt.counts[i]++
+		}
+	}
+}
+
+func unixProtocol(sockType uint8) string {
+	switch sockType {
+	case unix.SOCK_STREAM:
+		return "unix_stream"
+	case unix.SOCK_DGRAM:
+		return "unix_dgram"
+	case unix.SOCK_SEQPACKET:
+		return "unix_seqpacket"
+	}
+	return "unix"
+}
+
+func (c *collector) addUnix(obj *diag.UnixObject) {
+	protocol := unixProtocol(obj.Type)
+	c.sockets[seriesKey{protocol: protocol, state: obj.SockState().String()}]++
+	if obj.RQLen != nil {
+		c.recvQ[protocol] += uint64(obj.RQLen.RQueue)
+		c.sendQ[protocol] += uint64(obj.RQLen.WQueue)
+	}
+}
+
+func protocolSamples(m map[string]uint64) []Sample {
+	samples := make([]Sample, 0, len(m))
+	for protocol, v := range m {
+		samples = append(samples, Sample{
+			Labels: []Label{{"protocol", protocol}},
+			Value:  float64(v),
+		})
+	}
+	sortSamples(samples)
+	return samples
+}
+
+func sortSamples(samples []Sample) {
+	key := func(s Sample) string {
+		var b strings.Builder
+		for _, l := range s.Labels {
+			b.WriteString(l.Value)
+			b.WriteByte(0)
+		}
+		return b.String()
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return key(samples[i]) < key(samples[j])
+	})
+}
+
+func (c *collector) families() []MetricFamily {
+	ns := c.cfg.Namespace + "_"
+
+	sockets := make([]Sample, 0, len(c.sockets))
+	for key, n := range c.sockets {
+		labels := []Label{{"protocol", key.protocol}, {"state", key.state}}
+		if key.port != "" {
+			labels = append(labels, Label{"port", key.port})
+		}
+		sockets = append(sockets, Sample{Labels: labels, Value: float64(n)})
+	}
+	sortSamples(sockets)
+
+	families := []MetricFamily{
+		{
+			Name:    ns + "sockets",
+			Type:    Gauge,
+			Help:    "Number of sockets by protocol and state.",
+			Samples: sockets,
+		},
+		{
+			Name:    ns + "socket_receive_queue",
+			Type:    Gauge,
+			Help:    "Sum of the receive queues of all sockets.",
+			Samples: protocolSamples(c.recvQ),
+		},
+		{
+			Name:    ns + "socket_send_queue",
+			Type:    Gauge,
+			Help:    "Sum of the send queues of all sockets.",
+			Samples: protocolSamples(c.sendQ),
+		},
+		{
+			Name:    ns + "socket_drops",
+			Type:    Gauge,
+			Help:    "Sum of the packets dropped by all open TCP and UDP sockets.",
+			Samples: protocolSamples(c.drops),
+		},
+	}
+	if c.cfg.Sources&SourceTCP == 0 {
+		return families
+	}
+
+	families = append(families, MetricFamily{
+		Name:    ns + "tcp_retransmits",
+		Type:    Gauge,
+		Help:    "Sum of the retransmitted segments of all open TCP sockets.",
+		Samples: []Sample{{Value: float64(c.retrans)}},
+	})
+	if c.cfg.DisableRTTHistogram {
+		return families
+	}
+
+	rtt := MetricFamily{
+		Name: ns + "tcp_rtt_seconds",
+		Type: Histogram,
+		Help: "Smoothed round trip time of TCP sockets.",
+	}
+	for i, bound := range c.cfg.RTTBuckets {
+		rtt.Samples = append(rtt.Samples, Sample{
+			Suffix: "_bucket",
+			Labels: []Label{{"le", formatFloat(bound)}},
+			Value:  float64(c.rtt.counts[i]),
+		})
+	}
+	rtt.Samples = append(rtt.Samples,
+		Sample{Suffix: "_bucket", Labels: []Label{{"le", "+Inf"}}, Value: float64(c.rtt.count)},
+		Sample{Suffix: "_count", Value: float64(c.rtt.count)},
+		Sample{Suffix: "_sum", Value: c.rtt.sum},
+	)
+	return append(families, rtt)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// Encode writes families in the OpenMetrics text format to w.
+func Encode(w io.Writer, families []MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, f.Help)
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name + s.Suffix)
+			if len(s.Labels) != 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, `%s="%s"`, l.Name, labelEscaper.Replace(l.Value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatFloat(s.Value) + "\n")
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// WriteTo collects the metrics and writes them in the OpenMetrics text
+// format to w.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	families, err := e.Collect()
+	if err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: w}
+	err = Encode(cw, families)
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families, err := e.Collect()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	Encode(w, families)
+}
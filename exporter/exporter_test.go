@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"github.com/florianl/go-diag"
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+var _ Dumper = (*diag.Diag)(nil)
+
+type fakeDumper struct {
+	net  map[uint8][]diag.NetObject
+	unix []diag.UnixObject
+
+	// ext records the extensions requested per protocol.
+	ext map[uint8]uint8
+}
+
+func (f *fakeDumper) NetDump(opt *diag.NetOption) ([]diag.NetObject, error) {
+	if f.ext == nil {
+		f.ext = make(map[uint8]uint8)
+	}
+	f.ext[opt.Protocol] = opt.Ext
+	if opt.Family != unix.AF_INET {
+		return nil, nil
+	}
+	return f.net[opt.Protocol], nil
+}
+
+func (f *fakeDumper) UnixDump(opt *diag.UnixOption) ([]diag.UnixObject, error) {
+	return f.unix, nil
+}
+
+func tcpSocket(local string, state diag.SockState, rtt uint32) diag.NetObject {
+	obj := diag.NetObject{
+		DiagMsg: diag.DiagMsg{
+			Family: unix.AF_INET,
+			State:  uint8(state),
+			RQueue: 1,
+			WQueue: 2,
+			ID: diag.NewSockID(netip.MustParseAddrPort(local),
+				netip.MustParseAddrPort("192.0.2.1:50000")),
+		},
+	}
+	obj.TcpInfo = &diag.TcpInfo{Rtt: rtt, RotalRetrans: 3}
+	obj.SkMemInfo = &diag.SkMemInfo{Drops: 1}
+	return obj
+}
+
+func TestExporter(t *testing.T) {
+	d := &fakeDumper{
+		net: map[uint8][]diag.NetObject{
+			unix.IPPROTO_TCP: {
+				tcpSocket("10.0.0.1:22", diag.StateEstablished, 500),
+				tcpSocket("10.0.0.1:443", diag.StateEstablished, 20000),
+				tcpSocket("10.0.0.1:443", diag.StateListen, 0),
+				tcpSocket("10.0.0.1:443", diag.StateSynSent, 0),
+			},
+		},
+		unix: []diag.UnixObject{
+			{UnixDiagMsg: diag.UnixDiagMsg{Type: unix.SOCK_DGRAM, State: uint8(diag.StateClose)}},
+		},
+	}
+
+	e := New(d, &Config{
+		Namespace:  "test",
+		Sources:    SourceTCP | SourceUnix,
+		RTTBuckets: []float64{0.01, 0.001},
+		Ports:      []uint16{22},
+	})
+	var buf bytes.Buffer
+	if _, err := e.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# TYPE test_sockets gauge
+# HELP test_sockets Number of sockets by protocol and state.
+test_sockets{protocol="tcp",state="ESTAB",port="22"} 1
+test_sockets{protocol="tcp",state="ESTAB",port="other"} 1
+test_sockets{protocol="tcp",state="LISTEN",port="other"} 1
+test_sockets{protocol="tcp",state="SYN-SENT",port="other"} 1
+test_sockets{protocol="unix_dgram",state="UNCONN"} 1
+# TYPE test_socket_receive_queue gauge
+# HELP test_socket_receive_queue Sum of the receive queues of all sockets.
+test_socket_receive_queue{protocol="tcp"} 4
+# TYPE test_socket_send_queue gauge
+# HELP test_socket_send_queue Sum of the send queues of all sockets.
+test_socket_send_queue{protocol="tcp"} 8
+# TYPE test_socket_drops gauge
+# HELP test_socket_drops Sum of the packets dropped by all open TCP and UDP sockets.
+test_socket_drops{protocol="tcp"} 4
+# TYPE test_tcp_retransmits gauge
+# HELP test_tcp_retransmits Sum of the retransmitted segments of all open TCP sockets.
+test_tcp_retransmits 12
+# TYPE test_tcp_rtt_seconds histogram
+# HELP test_tcp_rtt_seconds Smoothed round trip time of TCP sockets.
+test_tcp_rtt_seconds_bucket{le="0.001"} 1
+test_tcp_rtt_seconds_bucket{le="0.01"} 1
+test_tcp_rtt_seconds_bucket{le="+Inf"} 2
+test_tcp_rtt_seconds_count 2
+test_tcp_rtt_seconds_sum 0.0205
+# EOF
+`
+	if got := buf.String(); got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestExporterDisableRTTHistogram(t *testing.T) {
+	d := &fakeDumper{
+		net: map[uint8][]diag.NetObject{
+			unix.IPPROTO_TCP: {tcpSocket("10.0.0.1:22", diag.StateEstablished, 500)},
+		},
+	}
+
+	e := New(d, &Config{Sources: SourceTCP, DisableRTTHistogram: true})
+	families, err := e.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ext[unix.IPPROTO_TCP]&diag.ExtInfo == 0 {
+		t.Errorf("expected ExtInfo to be requested for TCP")
+	}
+	var retransmits bool
+	for _, f := range families {
+		switch f.Name {
+		case "diag_tcp_retransmits":
+			retransmits = len(f.Samples) == 1 && f.Samples[0].Value == 3
+		case "diag_tcp_rtt_seconds":
+			t.Errorf("expected no RTT histogram")
+		}
+	}
+	if !retransmits {
+		t.Errorf("expected tcp_retransmits of 3, got %+v", families)
+	}
+}
+
+func TestEncodeEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	err := Encode(&buf, []MetricFamily{{
+		Name:    "x",
+		Type:    Gauge,
+		Help:    "h",
+		Samples: []Sample{{Labels: []Label{{"l", "a\"b\\c\n"}}, Value: 1}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# TYPE x gauge\n# HELP x h\nx{l=\"a\\\"b\\\\c\\n\"} 1\n# EOF\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
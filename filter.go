@@ -0,0 +1,614 @@
+package diag
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/florianl/go-diag/internal/services"
+)
+
+// Filter is a parsed filter expression in the syntax of ss, like
+//
+//	dport = :443 and ( src 10.0.0.0/8 or state established )
+//
+// Set NetOption.Filter to apply it to NetDump. The parts of the expression
+// that the kernel understands are compiled to INET_DIAG_REQ_BYTECODE,
+// the remaining parts are evaluated on the decoded sockets.
+//
+// The following predicates are supported:
+//
+//	src|dst ADDR[/PREFIX][:PORT]
+//	sport|dport OP [:]PORT      with OP one of = != < <= > >= eq ne lt le gt ge
+//	dev [=|!=] NAME|INDEX
+//	mark [=|!=] MARK[/MASK]
+//	cgroup [=|!=] PATH
+//	autobound
+//	state|exclude STATE-NAME
+//
+// PORT is a number or a service name from /etc/services, like http.
+// Predicates are combined with and, or, not and parentheses. As in ss,
+// two predicates next to each other are combined with and.
+type Filter struct {
+	expr filterNode
+
+	// states is the state mask derived from top-level state predicates.
+	states    uint32
+	hasStates bool
+	// kernel holds the compiled part of the expression, if any.
+	kernel []byte
+	// local holds the parts of the expression that are evaluated
+	// on decoded sockets.
+	local []filterNode
+}
+
+// ParseFilter parses a filter expression in the syntax of ss.
+func ParseFilter(expr string) (*Filter, error) {
+	p := &filterParser{tokens: tokenizeFilter(expr)}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("filter: unexpected %q", p.tokens[p.pos])
+	}
+	return newFilter(node)
+}
+
+func newFilter(node filterNode) (*Filter, error) {
+	f := &Filter{expr: node, states: AllStates}
+
+	var kernel []filterNode
+	for _, part := range splitAnd(node) {
+		if mask, ok := stateOnly(part); ok {
+			f.states &= mask
+			f.hasStates = true
+			continue
+		}
+		if _, ok := part.bytecode(); ok {
+			kernel = append(kernel, part)
+			continue
+		}
+		if usesAutobound(part) {
+			return nil, fmt.Errorf("filter: autobound can only be combined with and")
+		}
+		f.local = append(f.local, part)
+	}
+	if len(kernel) != 0 {
+		node := kernel[0]
+		for _, part := range kernel[1:] {
+			node = &andNode{a: node, b: part}
+		}
+		f.kernel, _ = node.bytecode()
+	}
+	return f, nil
+}
+
+// States returns the state mask selected by top-level state predicates.
+// The boolean is false, if the expression does not restrict states in
+// a way that can be expressed as state mask.
+func (f *Filter) States() (uint32, bool) {
+	return f.states, f.hasStates
+}
+
+// StatesOnly reports whether the expression only consists of state
+// predicates, so that States describes it completely.
+func (f *Filter) StatesOnly() bool {
+	return f.hasStates && f.kernel == nil && f.local == nil
+}
+
+// Bytecode returns the expression compiled to INET_DIAG_REQ_BYTECODE.
+// It returns an error, if the expression contains predicates the
+// kernel can not evaluate, like state.
+func (f *Filter) Bytecode() ([]byte, error) {
+	bc, ok := f.expr.bytecode()
+	if !ok {
+		return nil, fmt.Errorf("filter: expression can not be compiled: %w", ErrNotSupported)
+	}
+	return bc, nil
+}
+
+// Match evaluates the expression on obj. As the information is not part
+// of NetObject, autobound never matches.
+func (f *Filter) Match(obj *NetObject) bool {
+	return f.expr.match(obj)
+}
+
+// matchLocal evaluates the parts of the expression that are not handled
+// by the kernel.
+func (f *Filter) matchLocal(obj *NetObject) bool {
+	for _, part := range f.local {
+		if !part.match(obj) {
+			return false
+		}
+	}
+	return true
+}
+
+type filterNode interface {
+	// match evaluates the node on obj.
+	match(obj *NetObject) bool
+	// bytecode compiles the node. It returns false, if the node
+	// can not be evaluated by the kernel.
+	bytecode() ([]byte, bool)
+}
+
+type andNode struct{ a, b filterNode }
+
+type orNode struct{ a, b filterNode }
+
+type notNode struct{ n filterNode }
+
+// hostCond matches the address and port of one end of a socket.
+type hostCond struct {
+	dst    bool
+	prefix netip.Prefix // invalid prefix matches any address
+	port   int          // -1 matches any port
+}
+
+type portOp uint8
+
+const (
+	portEQ portOp = iota
+	portGE
+	portLE
+)
+
+// portCond compares the port of one end of a socket.
+type portCond struct {
+	dst  bool
+	op   portOp
+	port uint16
+}
+
+type devCond struct{ ifindex uint32 }
+
+type markCond struct{ mark, mask uint32 }
+
+type cgroupCond struct{ id uint64 }
+
+type autoboundCond struct{}
+
+type stateCond struct{ mask uint32 }
+
+func (n *andNode) match(obj *NetObject) bool { return n.a.match(obj) && n.b.match(obj) }
+
+func (n *orNode) match(obj *NetObject) bool { return n.a.match(obj) || n.b.match(obj) }
+
+func (n *notNode) match(obj *NetObject) bool { return !n.n.match(obj) }
+
+func (c *hostCond) match(obj *NetObject) bool {
+	ap := obj.ID.Local(obj.Family)
+	if c.dst {
+		ap = obj.ID.Remote(obj.Family)
+	}
+	if c.port != -1 && int(ap.Port()) != c.port {
+		return false
+	}
+	if !c.prefix.IsValid() {
+		return true
+	}
+	return c.prefix.Contains(ap.Addr())
+}
+
+func (c *portCond) match(obj *NetObject) bool {
+	port := Ntohs(obj.ID.SPort)
+	if c.dst {
+		port = Ntohs(obj.ID.DPort)
+	}
+	switch c.op {
+	case portGE:
+		return port >= c.port
+	case portLE:
+		return port <= c.port
+	}
+	return port == c.port
+}
+
+func (c *devCond) match(obj *NetObject) bool { return obj.ID.If == c.ifindex }
+
+func (c *markCond) match(obj *NetObject) bool {
+	return obj.Mark != nil && *obj.Mark&c.mask == c.mark
+}
+
+func (c *cgroupCond) match(obj *NetObject) bool {
+	return obj.CGroupID != nil && *obj.CGroupID == c.id
+}
+
+func (c *autoboundCond) match(obj *NetObject) bool { return false }
+
+func (c *stateCond) match(obj *NetObject) bool { return c.mask&(1<<obj.State) != 0 }
+
+// splitAnd returns the operands of top-level and operations.
+func splitAnd(node filterNode) []filterNode {
+	if n, ok := node.(*andNode); ok {
+		return append(splitAnd(n.a), splitAnd(n.b)...)
+	}
+	return []filterNode{node}
+}
+
+// stateOnly returns the state mask, if node only consists of state predicates.
+func stateOnly(node filterNode) (uint32, bool) {
+	switch n := node.(type) {
+	case *stateCond:
+		return n.mask, true
+	case *notNode:
+		mask, ok := stateOnly(n.n)
+		return ^mask, ok
+	case *andNode:
+		a, okA := stateOnly(n.a)
+		b, okB := stateOnly(n.b)
+		return a & b, okA && okB
+	case *orNode:
+		a, okA := stateOnly(n.a)
+		b, okB := stateOnly(n.b)
+		return a | b, okA && okB
+	}
+	return 0, false
+}
+
+func usesAutobound(node filterNode) bool {
+	switch n := node.(type) {
+	case *autoboundCond:
+		return true
+	case *notNode:
+		return usesAutobound(n.n)
+	case *andNode:
+		return usesAutobound(n.a) || usesAutobound(n.b)
+	case *orNode:
+		return usesAutobound(n.a) || usesAutobound(n.b)
+	}
+	return false
+}
+
+// tokenizeFilter splits expr into words, parentheses and operators.
+func tokenizeFilter(expr string) []string {
+	var tokens []string
+	isOp := func(c byte) bool { return strings.IndexByte("=!<>&|,", c) >= 0 }
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case isOp(c):
+			j := i + 1
+			for j < len(expr) && isOp(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			j := i + 1
+			for j < len(expr) && !strings.ContainsRune(" \t\n()", rune(expr[j])) && !isOp(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("filter: unexpected end of expression")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "or", "|", "||", ",":
+			p.pos++
+		default:
+			return node, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node = &orNode{a: node, b: right}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "and", "&", "&&":
+			p.pos++
+		case "", ")", "or", "|", "||", ",":
+			return node, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node = &andNode{a: node, b: right}
+	}
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case "not", "!":
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n: node}, nil
+	case "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, err := p.next(); err != nil || tok != ")" {
+			return nil, fmt.Errorf("filter: missing closing parenthesis")
+		}
+		return node, nil
+	case "src", "dst":
+		arg, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if arg == "=" || arg == "==" {
+			if arg, err = p.next(); err != nil {
+				return nil, err
+			}
+		}
+		return parseHostCond(tok == "dst", arg)
+	case "sport", "dport":
+		return p.parsePort(tok == "dport")
+	case "dev":
+		return p.parseWithOp(func(arg string) (filterNode, error) {
+			return parseDevCond(arg)
+		})
+	case "mark", "fwmark":
+		return p.parseWithOp(parseMarkCond)
+	case "cgroup":
+		return p.parseWithOp(parseCGroupCond)
+	case "autobound":
+		return &autoboundCond{}, nil
+	case "state", "exclude", "excl":
+		name, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		mask, err := ParseState(name)
+		if err != nil {
+			return nil, fmt.Errorf("filter: %w", err)
+		}
+		if tok == "state" {
+			return &stateCond{mask: mask}, nil
+		}
+		return &notNode{n: &stateCond{mask: mask}}, nil
+	}
+	return nil, fmt.Errorf("filter: unexpected %q", tok)
+}
+
+// parseWithOp parses an optional = or != followed by an argument.
+func (p *filterParser) parseWithOp(parse func(arg string) (filterNode, error)) (filterNode, error) {
+	arg, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	negate := false
+	switch arg {
+	case "=", "==", "eq":
+		arg, err = p.next()
+	case "!=", "ne", "neq":
+		negate = true
+		arg, err = p.next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	node, err := parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if negate {
+		return &notNode{n: node}, nil
+	}
+	return node, nil
+}
+
+func (p *filterParser) parsePort(dst bool) (filterNode, error) {
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	arg := op
+	if portOps[op] {
+		if arg, err = p.next(); err != nil {
+			return nil, err
+		}
+	} else {
+		op = "="
+	}
+	port, err := parseFilterPort(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	eq := &portCond{dst: dst, op: portEQ, port: port}
+	ge := &portCond{dst: dst, op: portGE, port: port}
+	le := &portCond{dst: dst, op: portLE, port: port}
+	switch op {
+	case "=", "==", "eq":
+		return eq, nil
+	case "!=", "ne", "neq":
+		return &notNode{n: eq}, nil
+	case ">=", "ge", "geq":
+		return ge, nil
+	case "<=", "le", "leq":
+		return le, nil
+	case ">", "gt":
+		return &notNode{n: le}, nil
+	default: // "<", "lt"
+		return &notNode{n: ge}, nil
+	}
+}
+
+// portOps are the operators of sport and dport.
+var portOps = map[string]bool{
+	"=": true, "==": true, "eq": true,
+	"!=": true, "ne": true, "neq": true,
+	">=": true, "ge": true, "geq": true,
+	"<=": true, "le": true, "leq": true,
+	">": true, "gt": true,
+	"<": true, "lt": true,
+}
+
+// lookupPort resolves service names in port predicates.
+var lookupPort = func(name string) (uint16, bool) {
+	return services.Default().Port(name)
+}
+
+func parseFilterPort(s string) (uint16, error) {
+	name := strings.TrimPrefix(s, ":")
+	if port, err := strconv.ParseUint(name, 10, 16); err == nil {
+		return uint16(port), nil
+	}
+	if port, ok := lookupPort(name); ok {
+		return port, nil
+	}
+	return 0, fmt.Errorf("filter: invalid port %q", s)
+}
+
+// parseHostCond parses ADDR[/PREFIX][:PORT] where ADDR can be *, an IPv4
+// address or an IPv6 address in brackets.
+func parseHostCond(dst bool, s string) (filterNode, error) {
+	cond := &hostCond{dst: dst, port: -1}
+	host := s
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("filter: invalid address %q", s)
+		}
+		host = s[1:end]
+		rest := s[end+1:]
+		if strings.HasPrefix(rest, "/") {
+			bits, port, _ := strings.Cut(rest[1:], ":")
+			host += "/" + bits
+			rest = ":" + port
+			if port == "" {
+				rest = ""
+			}
+		}
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return nil, fmt.Errorf("filter: invalid address %q", s)
+			}
+			if err := cond.setPort(rest[1:]); err != nil {
+				return nil, err
+			}
+		}
+	} else if _, err := netip.ParseAddr(s); err != nil {
+		if _, err := netip.ParsePrefix(s); err != nil {
+			if i := strings.LastIndexByte(s, ':'); i >= 0 {
+				host = s[:i]
+				if err := cond.setPort(s[i+1:]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if host == "" || host == "*" {
+		return cond, nil
+	}
+	if strings.Contains(host, "/") {
+		prefix, err := netip.ParsePrefix(host)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid prefix %q", host)
+		}
+		cond.prefix = prefix.Masked()
+		return cond, nil
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil, fmt.Errorf("filter: invalid address %q", host)
+	}
+	cond.prefix = netip.PrefixFrom(addr, addr.BitLen())
+	return cond, nil
+}
+
+func (c *hostCond) setPort(s string) error {
+	if s == "*" || s == "" {
+		return nil
+	}
+	port, err := parseFilterPort(s)
+	if err != nil {
+		return err
+	}
+	c.port = int(port)
+	return nil
+}
+
+func parseDevCond(s string) (filterNode, error) {
+	if index, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return &devCond{ifindex: uint32(index)}, nil
+	}
+	iface, err := net.InterfaceByName(s)
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	return &devCond{ifindex: uint32(iface.Index)}, nil
+}
+
+func parseMarkCond(s string) (filterNode, error) {
+	markStr, maskStr, hasMask := strings.Cut(s, "/")
+	mark, err := strconv.ParseUint(markStr, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("filter: invalid mark %q", s)
+	}
+	mask := uint64(0xFFFFFFFF)
+	if hasMask {
+		if mask, err = strconv.ParseUint(maskStr, 0, 32); err != nil {
+			return nil, fmt.Errorf("filter: invalid mark %q", s)
+		}
+	}
+	return &markCond{mark: uint32(mark & mask), mask: uint32(mask)}, nil
+}
+
+func parseCGroupCond(s string) (filterNode, error) {
+	root, err := cgroup2Mount()
+	if err != nil {
+		return nil, fmt.Errorf("filter: cgroup2 mount: %w", err)
+	}
+	id, err := fileInode(root + "/" + strings.TrimPrefix(s, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	return &cgroupCond{id: id}, nil
+}
@@ -0,0 +1,159 @@
+package diag
+
+import (
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// Based on the INET_DIAG_BC_* operations in include/uapi/linux/inet_diag.h
+const (
+	inetDiagBcNop = iota
+	inetDiagBcJmp
+	inetDiagBcSGe
+	inetDiagBcSLe
+	inetDiagBcDGe
+	inetDiagBcDLe
+	inetDiagBcAuto
+	inetDiagBcSCond
+	inetDiagBcDCond
+	inetDiagBcDevCond
+	inetDiagBcMarkCond
+	inetDiagBcSEq
+	inetDiagBcDEq
+	inetDiagBcCGroupCond
+)
+
+// inetDiagReqBytecode is the attribute type of INET_DIAG_REQ_BYTECODE.
+const inetDiagReqBytecode = 1
+
+// sizeOfBcOp is the size of inet_diag_bc_op.
+const sizeOfBcOp = 4
+
+// bcOp returns the encoding of inet_diag_bc_op. The kernel continues with
+// the instruction yes bytes ahead, if the condition is true, and no bytes
+// ahead otherwise. A filter matches, if execution ends exactly at the end
+// of the bytecode.
+func bcOp(code uint8, yes uint8, no uint16) []byte {
+	b := []byte{code, yes, 0, 0}
+	nativeEndian.PutUint16(b[2:], no)
+	return b
+}
+
+// bcCond returns an operation with the given operand. On failure it
+// jumps four bytes beyond the end of the operation, which rejects the
+// socket unless the jump is relocated by bcPatch.
+func bcCond(code uint8, operand []byte) []byte {
+	size := sizeOfBcOp + len(operand)
+	return append(bcOp(code, uint8(size), uint16(size+4)), operand...)
+}
+
+// bcPatch relocates the reject jumps of bc by reloc bytes. A jump is a
+// reject jump, if it targets four bytes beyond the end of bc.
+func bcPatch(bc []byte, reloc int) {
+	for off := 0; off < len(bc); {
+		remaining := len(bc) - off
+		no := int(nativeEndian.Uint16(bc[off+2:]))
+		if no == remaining+4 {
+			nativeEndian.PutUint16(bc[off+2:], uint16(no+reloc))
+		}
+		off += int(bc[off+1])
+	}
+}
+
+func (n *andNode) bytecode() ([]byte, bool) {
+	a, okA := n.a.bytecode()
+	b, okB := n.b.bytecode()
+	if !okA || !okB {
+		return nil, false
+	}
+	bcPatch(a, len(b))
+	return append(a, b...), true
+}
+
+func (n *orNode) bytecode() ([]byte, bool) {
+	a, okA := n.a.bytecode()
+	b, okB := n.b.bytecode()
+	if !okA || !okB {
+		return nil, false
+	}
+	// If a matches, jump over b to the end.
+	out := append(a, bcOp(inetDiagBcJmp, sizeOfBcOp, uint16(len(b)+sizeOfBcOp))...)
+	return append(out, b...), true
+}
+
+func (n *notNode) bytecode() ([]byte, bool) {
+	a, ok := n.n.bytecode()
+	if !ok {
+		return nil, false
+	}
+	// If a matches, jump beyond the end to reject. Otherwise a
+	// continues at the end and accepts.
+	return append(a, bcOp(inetDiagBcJmp, sizeOfBcOp, 2*sizeOfBcOp)...), true
+}
+
+func (c *hostCond) bytecode() ([]byte, bool) {
+	// Based on inet_diag_hostcond.
+	operand := make([]byte, 8)
+	operand[0] = 0 // AF_UNSPEC
+	port := int32(c.port)
+	nativeEndian.PutUint32(operand[4:], uint32(port))
+	if c.prefix.IsValid() {
+		operand[1] = uint8(c.prefix.Bits())
+		if c.prefix.Addr().Is4() {
+			operand[0] = unix.AF_INET
+			addr := c.prefix.Addr().As4()
+			operand = append(operand, addr[:]...)
+		} else {
+			operand[0] = unix.AF_INET6
+			addr := c.prefix.Addr().As16()
+			operand = append(operand, addr[:]...)
+		}
+	}
+	code := uint8(inetDiagBcSCond)
+	if c.dst {
+		code = inetDiagBcDCond
+	}
+	return bcCond(code, operand), true
+}
+
+func (c *portCond) bytecode() ([]byte, bool) {
+	codes := map[portOp][2]uint8{
+		portEQ: {inetDiagBcSEq, inetDiagBcDEq},
+		portGE: {inetDiagBcSGe, inetDiagBcDGe},
+		portLE: {inetDiagBcSLe, inetDiagBcDLe},
+	}[c.op]
+	code := codes[0]
+	if c.dst {
+		code = codes[1]
+	}
+	// The port is encoded in the no field of the following operation.
+	return bcCond(code, bcOp(0, 0, c.port)), true
+}
+
+func (c *devCond) bytecode() ([]byte, bool) {
+	operand := make([]byte, 4)
+	nativeEndian.PutUint32(operand, c.ifindex)
+	return bcCond(inetDiagBcDevCond, operand), true
+}
+
+func (c *markCond) bytecode() ([]byte, bool) {
+	// Based on inet_diag_markcond.
+	operand := make([]byte, 8)
+	nativeEndian.PutUint32(operand, c.mark)
+	nativeEndian.PutUint32(operand[4:], c.mask)
+	return bcCond(inetDiagBcMarkCond, operand), true
+}
+
+func (c *cgroupCond) bytecode() ([]byte, bool) {
+	operand := make([]byte, 8)
+	nativeEndian.PutUint64(operand, c.id)
+	return bcCond(inetDiagBcCGroupCond, operand), true
+}
+
+func (c *autoboundCond) bytecode() ([]byte, bool) {
+	return bcCond(inetDiagBcAuto, nil), true
+}
+
+func (c *stateCond) bytecode() ([]byte, bool) {
+	// The kernel filters states with the state mask of the request.
+	return nil, false
+}
@@ -0,0 +1,206 @@
+package diag
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// runBytecode interprets bc like inet_diag_bc_run in the kernel for the
+// operations the filter compiler emits.
+func runBytecode(t *testing.T, bc []byte, obj *NetObject) bool {
+	t.Helper()
+	off := 0
+	for off < len(bc) {
+		code, yes := bc[off], int(bc[off+1])
+		no := int(nativeEndian.Uint16(bc[off+2:]))
+		operand := bc[off+4:]
+		match := true
+		switch code {
+		case inetDiagBcJmp:
+			match = false
+		case inetDiagBcSEq, inetDiagBcDEq, inetDiagBcSGe, inetDiagBcDGe, inetDiagBcSLe, inetDiagBcDLe:
+			port := Ntohs(obj.ID.SPort)
+			if code == inetDiagBcDEq || code == inetDiagBcDGe || code == inetDiagBcDLe {
+				port = Ntohs(obj.ID.DPort)
+			}
+			want := nativeEndian.Uint16(operand[2:])
+			switch code {
+			case inetDiagBcSEq, inetDiagBcDEq:
+				match = port == want
+			case inetDiagBcSGe, inetDiagBcDGe:
+				match = port >= want
+			default:
+				match = port <= want
+			}
+		case inetDiagBcSCond, inetDiagBcDCond:
+			cond := &hostCond{dst: code == inetDiagBcDCond}
+			cond.port = int(int32(nativeEndian.Uint32(operand[4:])))
+			if bits := int(operand[1]); bits != 0 {
+				addr, _ := netip.AddrFromSlice(operand[8 : yes-sizeOfBcOp])
+				cond.prefix = netip.PrefixFrom(addr, bits)
+			}
+			match = cond.match(obj)
+		case inetDiagBcDevCond:
+			match = obj.ID.If == nativeEndian.Uint32(operand)
+		case inetDiagBcMarkCond:
+			mark := nativeEndian.Uint32(operand)
+			mask := nativeEndian.Uint32(operand[4:])
+			match = obj.Mark != nil && *obj.Mark&mask == mark
+		default:
+			t.Fatalf("unexpected operation %d", code)
+		}
+		if match {
+			off += yes
+		} else {
+			off += no
+		}
+	}
+	return off == len(bc)
+}
+
+func testSocket(family uint8, local, remote string, state SockState) NetObject {
+	obj := NetObject{DiagMsg: DiagMsg{Family: family, State: uint8(state)}}
+	obj.ID = NewSockID(netip.MustParseAddrPort(local), netip.MustParseAddrPort(remote))
+	return obj
+}
+
+func TestFilter(t *testing.T) {
+	mark := uint32(0x1234)
+	sockets := []NetObject{
+		testSocket(unix.AF_INET, "10.1.2.3:443", "192.0.2.1:50000", StateEstablished),
+		testSocket(unix.AF_INET, "127.0.0.1:8080", "127.0.0.1:40000", StateEstablished),
+		testSocket(unix.AF_INET, "0.0.0.0:22", "0.0.0.0:0", StateListen),
+		testSocket(unix.AF_INET6, "[::1]:443", "[::1]:60000", StateTimeWait),
+		testSocket(unix.AF_INET6, "[::ffff:10.0.0.1]:1024", "[2001:db8::1]:443", StateSynSent),
+	}
+	sockets[1].Mark = &mark
+
+	tests := map[string][]bool{
+		"sport = :443":                         {true, false, false, true, false},
+		"dport :443":                           {false, false, false, false, true},
+		"sport > :1024":                        {false, true, false, false, false},
+		"sport <= 1024 and sport ge :443":      {true, false, false, true, true},
+		"src 10.0.0.0/8":                       {true, false, false, false, true},
+		"src [::1]:443":                        {false, false, false, true, false},
+		"dst [2001:db8::]/32 or src *:22":      {false, false, true, false, true},
+		"not ( sport = :443 || sport = :22 )":  {false, true, false, false, true},
+		"src 127.0.0.1 mark = 0x1234":          {false, true, false, false, false},
+		"mark 0x1000/0xf000":                   {false, true, false, false, false},
+		"state established":                    {true, true, false, false, false},
+		"exclude listening sport != :443":      {false, true, false, false, true},
+		"dport = :443 or state time-wait":      {false, false, false, true, true},
+		"( dst 192.0.2.1 or state listening )": {true, false, true, false, false},
+	}
+
+	for expr, expected := range tests {
+		t.Run(expr, func(t *testing.T) {
+			f, err := ParseFilter(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			states, _ := f.States()
+			for i := range sockets {
+				if got := f.Match(&sockets[i]); got != expected[i] {
+					t.Errorf("Match(%d): expected %v, got %v", i, expected[i], got)
+				}
+
+				// Evaluate the filter the way NetDump does.
+				got := states&(1<<sockets[i].State) != 0 && f.matchLocal(&sockets[i])
+				if got && len(f.kernel) != 0 {
+					got = runBytecode(t, f.kernel, &sockets[i])
+				}
+				if got != expected[i] {
+					t.Errorf("kernel(%d): expected %v, got %v", i, expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterBytecode(t *testing.T) {
+	f, err := ParseFilter("dport = :443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := f.Bytecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(bcOp(inetDiagBcDEq, 8, 12), bcOp(0, 0, 443)...)
+	if string(bc) != string(expected) {
+		t.Fatalf("expected %v, got %v", expected, bc)
+	}
+
+	f, err = ParseFilter("state established or dport = :443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Bytecode(); err == nil {
+		t.Fatalf("expected error for state in bytecode")
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"sport",
+		"( sport = :22",
+		"src 10.0.0.0/33",
+		"state foo",
+		"mark = abc",
+		"foo",
+		"autobound or state listening",
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q): expected error", expr)
+		}
+	}
+}
+
+func TestParseFilterServices(t *testing.T) {
+	lookup := lookupPort
+	defer func() { lookupPort = lookup }()
+	lookupPort = func(name string) (uint16, bool) {
+		if name == "http" {
+			return 80, true
+		}
+		return 0, false
+	}
+
+	socket := testSocket(unix.AF_INET, "10.1.2.3:80", "192.0.2.1:50000", StateEstablished)
+	for _, expr := range []string{"sport = :http", "sport :http", "src 10.1.2.3:http"} {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", expr, err)
+		}
+		if !f.Match(&socket) {
+			t.Errorf("%q: expected match", expr)
+		}
+	}
+	if _, err := ParseFilter("sport = :foo"); err == nil {
+		t.Fatalf("expected error for unknown service")
+	}
+}
+
+func TestParseState(t *testing.T) {
+	for name, expected := range map[string]uint32{
+		"established": StateMask(StateEstablished),
+		"ESTABLISHED": StateMask(StateEstablished),
+		"unconnected": StateMask(StateClose),
+		"Bucket":      StateMask(StateSynRecv, StateTimeWait),
+		"big":         AllStates &^ StateMask(StateSynRecv, StateTimeWait),
+	} {
+		mask, err := ParseState(name)
+		if err != nil {
+			t.Fatalf("ParseState(%q): %v", name, err)
+		}
+		if mask != expected {
+			t.Errorf("ParseState(%q): expected 0x%x, got 0x%x", name, expected, mask)
+		}
+	}
+	if _, err := ParseState("foo"); err == nil {
+		t.Fatalf("expected error for unknown state")
+	}
+}
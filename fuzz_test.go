@@ -0,0 +1,69 @@
+package diag
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+)
+
+// The seed corpus in testdata/fuzz contains messages of a x86_64 kernel.
+
+func FuzzNetMessage(f *testing.F) {
+	f.Add([]byte{})
+	// inet_diag_msg followed by a truncated INET_DIAG_INFO.
+	f.Add(append(make([]byte, 72), 8, 0, inetDiagInfo, 0, 1, 2, 3, 4))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var obj, reused NetObject
+		err := decodeNetMessage(data, &obj, decodeOptions{})
+		errReused := NewNetDecoder(nil).Decode(data, &reused)
+		if (err == nil) != (errReused == nil) {
+			t.Fatalf("NetDecoder returned %v instead of %v", errReused, err)
+		}
+		if err == nil && !reflect.DeepEqual(obj, reused) {
+			t.Fatalf("NetDecoder decoded %+v instead of %+v", reused, obj)
+		}
+		if err := obj.UnmarshalBinary(data); err != nil {
+			return
+		}
+		encoded, err := obj.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := obj.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("decode of encoded message: %v", err)
+		}
+	})
+}
+
+func FuzzUnixMessage(f *testing.F) {
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var obj UnixObject
+		_ = decodeUnixMessage(data, &obj, decodeOptions{})
+		if err := obj.UnmarshalBinary(data); err != nil {
+			return
+		}
+		encoded, err := obj.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := obj.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("decode of encoded message: %v", err)
+		}
+	})
+}
+
+func FuzzHandleResponse(f *testing.F) {
+	f.Add([]byte{}, uint32(0))
+	f.Add(make([]byte, 72), uint32(NetAttrInfo))
+
+	f.Fuzz(func(t *testing.T, data []byte, mask uint32) {
+		msgs := []netlink.Message{{Data: data}}
+		opts := decodeOptions{netAttrs: NetAttrMask(mask), unixAttrs: UnixAttrMask(mask)}
+		_, _ = handleNetResponse(msgs, opts)
+		_, _ = handleUnixResponse(msgs, opts)
+	})
+}
@@ -0,0 +1,85 @@
+// Package services resolves port numbers and service names with the
+// format of /etc/services.
+package services
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Table maps between ports and service names.
+type Table struct {
+	// names maps "port/protocol" to the service name.
+	names map[string]string
+	// ports maps service names and aliases to the port.
+	ports map[string]uint16
+}
+
+// Parse parses the format of /etc/services. For ports and names that
+// appear several times, the first entry wins.
+func Parse(r io.Reader) *Table {
+	t := &Table{names: make(map[string]string), ports: make(map[string]uint16)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if _, ok := t.names[fields[1]]; !ok {
+			t.names[fields[1]] = fields[0]
+		}
+		portStr, _, _ := strings.Cut(fields[1], "/")
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			continue
+		}
+		t.addPort(fields[0], uint16(port))
+		for _, alias := range fields[2:] {
+			t.addPort(alias, uint16(port))
+		}
+	}
+	return t
+}
+
+func (t *Table) addPort(name string, port uint16) {
+	if _, ok := t.ports[name]; !ok {
+		t.ports[name] = port
+	}
+}
+
+// Name returns the service name of port for protocol, like tcp or udp.
+func (t *Table) Name(port uint16, protocol string) (string, bool) {
+	name, ok := t.names[strconv.Itoa(int(port))+"/"+protocol]
+	return name, ok
+}
+
+// Port returns the port of the service name or alias.
+func (t *Table) Port(name string) (uint16, bool) {
+	port, ok := t.ports[name]
+	return port, ok
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultTable *Table
+)
+
+// Default returns the table of /etc/services. It is read on first use.
+// If the file can not be read, the table is empty.
+func Default() *Table {
+	defaultOnce.Do(func() {
+		defaultTable = &Table{}
+		f, err := os.Open("/etc/services")
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		defaultTable = Parse(f)
+	})
+	return defaultTable
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	table := Parse(strings.NewReader(`# comment
+ssh		22/tcp				# SSH Remote Login Protocol
+domain		53/tcp
+domain		53/udp
+http		80/tcp		www		# WorldWideWeb HTTP
+`))
+	for _, test := range []struct {
+		port     uint16
+		protocol string
+		name     string
+	}{
+		{22, "tcp", "ssh"},
+		{53, "udp", "domain"},
+		{80, "tcp", "http"},
+	} {
+		if name, ok := table.Name(test.port, test.protocol); !ok || name != test.name {
+			t.Errorf("Name(%d, %s): expected %q, got %q", test.port, test.protocol, test.name, name)
+		}
+		if port, ok := table.Port(test.name); !ok || port != test.port {
+			t.Errorf("Port(%s): expected %d, got %d", test.name, test.port, port)
+		}
+	}
+	if _, ok := table.Name(22, "udp"); ok {
+		t.Fatalf("unexpected service 22/udp")
+	}
+	if port, ok := table.Port("www"); !ok || port != 80 {
+		t.Fatalf("expected alias www for port 80, got %d", port)
+	}
+	if _, ok := table.Port("foo"); ok {
+		t.Fatalf("unexpected service foo")
+	}
+}
@@ -18,4 +18,9 @@ const (
 	NETLINK_SOCK_DIAG = linux.NETLINK_SOCK_DIAG
 
 	SOCK_DIAG_BY_FAMILY = linux.SOCK_DIAG_BY_FAMILY
+	SOCK_DESTROY        = linux.SOCK_DESTROY
+
+	SOCK_STREAM    = linux.SOCK_STREAM
+	SOCK_DGRAM     = linux.SOCK_DGRAM
+	SOCK_SEQPACKET = linux.SOCK_SEQPACKET
 )
@@ -15,4 +15,9 @@ const (
 
 	NETLINK_SOCK_DIAG   = 4
 	SOCK_DIAG_BY_FAMILY = 20
+	SOCK_DESTROY        = 21
+
+	SOCK_STREAM    = 1
+	SOCK_DGRAM     = 2
+	SOCK_SEQPACKET = 5
 )
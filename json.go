@@ -0,0 +1,376 @@
+package diag
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// JSONSchemaVersion is the version of the JSON representation of NetObject
+// and UnixObject. It is part of every encoded object as schema_version and
+// is incremented on incompatible changes.
+//
+// Version 1 encodes addresses as "ip:port", states, timers and shutdown
+// modes by their names as returned by String() and durations, like expires
+// or rtt of TcpInfo, in the format of time.Duration.String(). Cookies are
+// decimal strings and abstract Unix socket names start with @. Attributes
+// that were not reported by the kernel are omitted. NetNSObject and
+// UnixNSObject add their namespace as netns.
+const JSONSchemaVersion = 1
+
+// MarshalText implements encoding.TextMarshaler.
+func (s SockState) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// MarshalText implements encoding.TextMarshaler.
+func (t TimerKind) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ShutdownMode) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// MarshalText implements encoding.TextMarshaler.
+func (s CAState) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// MarshalText implements encoding.TextMarshaler.
+func (f FastOpenFail) MarshalText() ([]byte, error) { return []byte(f.String()), nil }
+
+func familyName(family uint8) string {
+	switch family {
+	case unix.AF_INET:
+		return "inet"
+	case unix.AF_INET6:
+		return "inet6"
+	case unix.AF_UNIX:
+		return "unix"
+	}
+	return strconv.Itoa(int(family))
+}
+
+func protocolName(protocol uint8) string {
+	switch protocol {
+	case unix.IPPROTO_TCP:
+		return "tcp"
+	case unix.IPPROTO_UDP:
+		return "udp"
+	case unix.IPPROTO_SCTP:
+		return "sctp"
+	case unix.IPPROTO_RAW:
+		return "raw"
+	}
+	return strconv.Itoa(int(protocol))
+}
+
+func unixTypeName(sockType uint8) string {
+	switch sockType {
+	case unix.SOCK_STREAM:
+		return "stream"
+	case unix.SOCK_DGRAM:
+		return "dgram"
+	case unix.SOCK_SEQPACKET:
+		return "seqpacket"
+	}
+	return strconv.Itoa(int(sockType))
+}
+
+type sockOptJSON struct {
+	RecvErr           bool `json:"recverr"`
+	IsIcsk            bool `json:"is_icsk"`
+	Freebind          bool `json:"freebind"`
+	Hdrincl           bool `json:"hdrincl"`
+	McLoop            bool `json:"mc_loop"`
+	Transparent       bool `json:"transparent"`
+	McAll             bool `json:"mc_all"`
+	Nodefrag          bool `json:"nodefrag"`
+	BindAddressNoPort bool `json:"bind_address_no_port"`
+	RecvErrRFC4884    bool `json:"recverr_rfc4884"`
+	DeferConnect      bool `json:"defer_connect"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s SockOpt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sockOptJSON{
+		RecvErr:           s.RecvErr(),
+		IsIcsk:            s.IsIcsk(),
+		Freebind:          s.Freebind(),
+		Hdrincl:           s.Hdrincl(),
+		McLoop:            s.McLoop(),
+		Transparent:       s.Transparent(),
+		McAll:             s.McAll(),
+		Nodefrag:          s.Nodefrag(),
+		BindAddressNoPort: s.BindAddressNoPort(),
+		RecvErrRFC4884:    s.RecvErrRFC4884(),
+		DeferConnect:      s.DeferConnect(),
+	})
+}
+
+// omitted hides a field of an embedded struct from encoding/json.
+type omitted struct{}
+
+// tcpInfoFields has the fields of TcpInfo without its MarshalJSON method.
+type tcpInfoFields TcpInfo
+
+type tcpInfoJSON struct {
+	*tcpInfoFields
+
+	Rto           string `json:"rto"`
+	Ato           string `json:"ato"`
+	LastDataSent  string `json:"last_data_sent"`
+	LastAckSent   string `json:"last_ack_sent"`
+	LastDataRecv  string `json:"last_data_recv"`
+	LastAckRecv   string `json:"last_ack_recv"`
+	Rtt           string `json:"rtt"`
+	Rttvar        string `json:"rttvar"`
+	RcvRtt        string `json:"rcv_rtt"`
+	MinRtt        string `json:"min_rtt"`
+	BusyTime      string `json:"busy_time"`
+	RwndLimited   string `json:"rwnd_limited"`
+	SndbufLimited string `json:"sndbuf_limited"`
+	TotalRtoTime  string `json:"total_rto_time"`
+
+	// The durations above replace the raw values.
+	RtoUs           omitted `json:"rto_us,omitzero"`
+	AtoUs           omitted `json:"ato_us,omitzero"`
+	LastDataSentMs  omitted `json:"last_data_sent_ms,omitzero"`
+	LastAckSentMs   omitted `json:"last_ack_sent_ms,omitzero"`
+	LastDataRecvMs  omitted `json:"last_data_recv_ms,omitzero"`
+	LastAckRecvMs   omitted `json:"last_ack_recv_ms,omitzero"`
+	RttUs           omitted `json:"rtt_us,omitzero"`
+	RttvarUs        omitted `json:"rttvar_us,omitzero"`
+	RcvRttUs        omitted `json:"rcv_rtt_us,omitzero"`
+	MinRttUs        omitted `json:"min_rtt_us,omitzero"`
+	BusyTimeUs      omitted `json:"busy_time_us,omitzero"`
+	RwndLimitedUs   omitted `json:"rwnd_limited_us,omitzero"`
+	SndbufLimitedUs omitted `json:"sndbuf_limited_us,omitzero"`
+	TotalRtoTimeMs  omitted `json:"total_rto_time_ms,omitzero"`
+}
+
+// MarshalJSON implements json.Marshaler. Durations are encoded in the
+// format of time.Duration.String().
+func (t TcpInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tcpInfoJSON{
+		tcpInfoFields: (*tcpInfoFields)(&t),
+		Rto:           t.RtoDuration().String(),
+		Ato:           t.AtoDuration().String(),
+		LastDataSent:  t.LastDataSentDuration().String(),
+		LastAckSent:   t.LastAckSentDuration().String(),
+		LastDataRecv:  t.LastDataRecvDuration().String(),
+		LastAckRecv:   t.LastAckRecvDuration().String(),
+		Rtt:           t.RttDuration().String(),
+		Rttvar:        t.RttvarDuration().String(),
+		RcvRtt:        t.RcvRttDuration().String(),
+		MinRtt:        t.MinRttDuration().String(),
+		BusyTime:      t.BusyTimeDuration().String(),
+		RwndLimited:   t.RwndLimitedDuration().String(),
+		SndbufLimited: t.SndbufLimitedDuration().String(),
+		TotalRtoTime:  t.TotalRtoTimeDuration().String(),
+	})
+}
+
+// bbrInfoFields has the fields of BBRInfo without its MarshalJSON method.
+type bbrInfoFields BBRInfo
+
+type bbrInfoJSON struct {
+	*bbrInfoFields
+
+	MinRTT   string  `json:"min_rtt"`
+	MinRTTUs omitted `json:"min_rtt_us,omitzero"`
+}
+
+// MarshalJSON implements json.Marshaler. Durations are encoded in the
+// format of time.Duration.String().
+func (b BBRInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bbrInfoJSON{
+		bbrInfoFields: (*bbrInfoFields)(&b),
+		MinRTT:        b.MinRTTDuration().String(),
+	})
+}
+
+// vegasInfoFields has the fields of VegasInfo without its MarshalJSON method.
+type vegasInfoFields VegasInfo
+
+type vegasInfoJSON struct {
+	*vegasInfoFields
+
+	Rtt      string  `json:"rtt"`
+	MinRtt   string  `json:"min_rtt"`
+	RttUs    omitted `json:"rtt_us,omitzero"`
+	MinRttUs omitted `json:"min_rtt_us,omitzero"`
+}
+
+// MarshalJSON implements json.Marshaler. Durations are encoded in the
+// format of time.Duration.String().
+func (v VegasInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vegasInfoJSON{
+		vegasInfoFields: (*vegasInfoFields)(&v),
+		Rtt:             usec(v.Rtt).String(),
+		MinRtt:          usec(v.MinRtt).String(),
+	})
+}
+
+type netObjectJSON struct {
+	SchemaVersion int       `json:"schema_version"`
+	Family        string    `json:"family"`
+	Protocol      string    `json:"protocol,omitempty"`
+	State         SockState `json:"state"`
+	Local         string    `json:"local"`
+	Remote        string    `json:"remote"`
+	Interface     uint32    `json:"interface,omitempty"`
+	Cookie        string    `json:"cookie"`
+	Timer         TimerKind `json:"timer"`
+	Expires       string    `json:"expires,omitempty"`
+	Retrans       uint8     `json:"retrans"`
+	RecvQ         uint32    `json:"recv_q"`
+	SendQ         uint32    `json:"send_q"`
+	UID           uint32    `json:"uid"`
+	Inode         uint32    `json:"inode"`
+
+	MemInfo   *MemInfo      `json:"meminfo,omitempty"`
+	SkMemInfo *SkMemInfo    `json:"skmeminfo,omitempty"`
+	Cong      *string       `json:"cong,omitempty"`
+	TOS       *uint8        `json:"tos,omitempty"`
+	TClass    *uint8        `json:"tclass,omitempty"`
+	Shutdown  *ShutdownMode `json:"shutdown,omitempty"`
+	V6Only    *bool         `json:"v6only,omitempty"`
+	Mark      *uint32       `json:"mark,omitempty"`
+	ClassID   *uint32       `json:"class_id,omitempty"`
+	CGroupID  *uint64       `json:"cgroup_id,omitempty"`
+	SockOpt   *SockOpt      `json:"sockopt,omitempty"`
+	TcpInfo   *TcpInfo      `json:"tcp_info,omitempty"`
+	SctpInfo  *SctpInfo     `json:"sctp_info,omitempty"`
+	VegasInfo *VegasInfo    `json:"vegas_info,omitempty"`
+	DCTCPInfo *DCTCPInfo    `json:"dctcp_info,omitempty"`
+	BBRInfo   *BBRInfo      `json:"bbr_info,omitempty"`
+
+	Unknown   []RawAttribute `json:"unknown,omitempty"`
+	Processes []Process      `json:"processes,omitempty"`
+	CGroup    *CGroup        `json:"cgroup,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. See JSONSchemaVersion for the format.
+func (o NetObject) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.jsonObject())
+}
+
+func (o *NetObject) jsonObject() netObjectJSON {
+	out := netObjectJSON{
+		SchemaVersion: JSONSchemaVersion,
+		Family:        familyName(o.Family),
+		State:         o.SockState(),
+		Local:         o.ID.Local(o.Family).String(),
+		Remote:        o.ID.Remote(o.Family).String(),
+		Interface:     o.ID.If,
+		Cookie:        strconv.FormatUint(o.ID.CookieValue(), 10),
+		Timer:         o.TimerKind(),
+		Retrans:       o.Retrans,
+		RecvQ:         o.RQueue,
+		SendQ:         o.WQueue,
+		UID:           o.UID,
+		Inode:         o.INode,
+
+		MemInfo:   o.MemInfo,
+		SkMemInfo: o.SkMemInfo,
+		Cong:      o.Cong,
+		TOS:       o.TOS,
+		TClass:    o.TClass,
+		Mark:      o.Mark,
+		ClassID:   o.ClassID,
+		CGroupID:  o.CGroupID,
+		SockOpt:   o.SockOpt,
+		TcpInfo:   o.TcpInfo,
+		SctpInfo:  o.SctpInfo,
+		VegasInfo: o.VegasInfo,
+		DCTCPInfo: o.DCTCPInfo,
+		BBRInfo:   o.BBRInfo,
+
+		Unknown:   o.Unknown,
+		Processes: o.Processes,
+		CGroup:    o.CGroup,
+	}
+	if o.Protocol != nil {
+		out.Protocol = protocolName(*o.Protocol)
+	}
+	if o.TimerKind() != TimerOff {
+		out.Expires = o.ExpiresDuration().String()
+	}
+	if mode, ok := o.ShutdownMode(); ok {
+		out.Shutdown = &mode
+	}
+	if o.SKV6Only != nil {
+		v6only := *o.SKV6Only != 0
+		out.V6Only = &v6only
+	}
+	return out
+}
+
+// MarshalJSON implements json.Marshaler. It adds NetNS as netns to the
+// encoding of NetObject.
+func (o NetNSObject) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		netObjectJSON
+		NetNS NetNS `json:"netns"`
+	}{o.NetObject.jsonObject(), o.NetNS})
+}
+
+type unixObjectJSON struct {
+	SchemaVersion int            `json:"schema_version"`
+	Family        string         `json:"family"`
+	Type          string         `json:"type"`
+	State         SockState      `json:"state"`
+	Inode         uint32         `json:"inode"`
+	Cookie        string         `json:"cookie"`
+	Name          *string        `json:"name,omitempty"`
+	Vfs           *UnixDiagVfs   `json:"vfs,omitempty"`
+	Peer          *uint32        `json:"peer,omitempty"`
+	Icons         []uint32       `json:"icons,omitempty"`
+	RQLen         *UnixDiagRqLen `json:"rqlen,omitempty"`
+	MemInfo       *MemInfo       `json:"meminfo,omitempty"`
+	Shutdown      *ShutdownMode  `json:"shutdown,omitempty"`
+	UID           *uint32        `json:"uid,omitempty"`
+
+	Unknown   []RawAttribute `json:"unknown,omitempty"`
+	Processes []Process      `json:"processes,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. See JSONSchemaVersion for the format.
+func (o UnixObject) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.jsonObject())
+}
+
+func (o *UnixObject) jsonObject() unixObjectJSON {
+	out := unixObjectJSON{
+		SchemaVersion: JSONSchemaVersion,
+		Family:        familyName(o.Family),
+		Type:          unixTypeName(o.Type),
+		State:         o.SockState(),
+		Inode:         o.Ino,
+		Cookie:        strconv.FormatUint(o.CookieValue(), 10),
+		Vfs:           o.Vfs,
+		Peer:          o.Peer,
+		Icons:         o.Icons,
+		RQLen:         o.RQLen,
+		MemInfo:       o.MemInfo,
+		UID:           o.UID,
+
+		Unknown:   o.Unknown,
+		Processes: o.Processes,
+	}
+	if o.Name != nil {
+		// Abstract socket names start with a null byte.
+		name := strings.Replace(*o.Name, "\x00", "@", 1)
+		out.Name = &name
+	}
+	if mode, ok := o.ShutdownMode(); ok {
+		out.Shutdown = &mode
+	}
+	return out
+}
+
+// MarshalJSON implements json.Marshaler. It adds NetNS as netns to the
+// encoding of UnixObject.
+func (o UnixNSObject) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		unixObjectJSON
+		NetNS NetNS `json:"netns"`
+	}{o.UnixObject.jsonObject(), o.NetNS})
+}
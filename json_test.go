@@ -0,0 +1,135 @@
+package diag
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestNetObjectJSON(t *testing.T) {
+	cong := "cubic"
+	protocol := uint8(unix.IPPROTO_TCP)
+	obj := NetObject{
+		DiagMsg: DiagMsg{
+			Family:  unix.AF_INET6,
+			State:   uint8(StateEstablished),
+			Timer:   1,
+			Expires: 200,
+			ID: NewSockID(netip.MustParseAddrPort("[2001:db8::1]:443"),
+				netip.MustParseAddrPort("[2001:db8::2]:50000")),
+		},
+		NetAttribute: NetAttribute{
+			Protocol: &protocol,
+			Cong:     &cong,
+			SockOpt:  &SockOpt{Bitfield1: 0x04},
+			TcpInfo:  &TcpInfo{Rtt: 1500, CaState: uint8(CARecovery)},
+		},
+	}
+	obj.ID.Cookie = [2]uint32{1, 1}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]interface{}{
+		"schema_version": float64(JSONSchemaVersion),
+		"family":         "inet6",
+		"protocol":       "tcp",
+		"state":          "ESTAB",
+		"local":          "[2001:db8::1]:443",
+		"remote":         "[2001:db8::2]:50000",
+		"cookie":         "4294967297",
+		"timer":          "on",
+		"expires":        "200ms",
+		"cong":           "cubic",
+	} {
+		if got[key] != expected {
+			t.Errorf("%s: expected %v, got %v", key, expected, got[key])
+		}
+	}
+	if _, ok := got["meminfo"]; ok {
+		t.Errorf("meminfo: expected to be omitted")
+	}
+	if sockOpt := got["sockopt"].(map[string]interface{}); sockOpt["freebind"] != true {
+		t.Errorf("sockopt: expected freebind, got %v", sockOpt)
+	}
+	info := got["tcp_info"].(map[string]interface{})
+	if info["rtt"] != "1.5ms" || info["ca_state"] != float64(CARecovery) {
+		t.Errorf("tcp_info: unexpected %v", info)
+	}
+	if _, ok := info["rtt_us"]; ok {
+		t.Errorf("tcp_info: expected rtt_us to be replaced by rtt")
+	}
+}
+
+func TestNetNSObjectJSON(t *testing.T) {
+	obj := NetNSObject{
+		NetNS: NetNS{Inode: 4026531840, Name: "pod", Path: "/run/netns/pod"},
+		NetObject: NetObject{
+			DiagMsg: DiagMsg{Family: unix.AF_INET, State: uint8(StateListen)},
+		},
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		State string `json:"state"`
+		NetNS NetNS  `json:"netns"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.State != "LISTEN" || got.NetNS != obj.NetNS {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+}
+
+func TestUnixNSObjectJSON(t *testing.T) {
+	obj := UnixNSObject{
+		NetNS: NetNS{Inode: 4026531840},
+		UnixObject: UnixObject{
+			UnixDiagMsg: UnixDiagMsg{Family: unix.AF_UNIX, Type: unix.SOCK_DGRAM,
+				State: uint8(StateClose), Ino: 42},
+		},
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"schema_version":1,"family":"unix","type":"dgram","state":"UNCONN","inode":42,"cookie":"0","netns":{"inode":4026531840}}`
+	if string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+}
+
+func TestUnixObjectJSON(t *testing.T) {
+	name := "\x00abstract"
+	obj := UnixObject{
+		UnixDiagMsg: UnixDiagMsg{
+			Family: unix.AF_UNIX,
+			Type:   unix.SOCK_STREAM,
+			State:  uint8(StateListen),
+			Ino:    42,
+		},
+		UnixAttribute: UnixAttribute{Name: &name},
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"schema_version":1,"family":"unix","type":"stream","state":"LISTEN","inode":42,"cookie":"0","name":"@abstract"}`
+	if string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+}
@@ -0,0 +1,156 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// NetNS describes a network namespace.
+type NetNS struct {
+	// Inode identifies the network namespace.
+	Inode uint64 `json:"inode"`
+	// Name is the name of the namespace in /run/netns, if any.
+	Name string `json:"name,omitempty"`
+	// Path is the file that refers to the namespace.
+	Path string `json:"path,omitempty"`
+}
+
+// NetNSFromPath returns the network namespace the file at path refers to,
+// e.g. /proc/1/ns/net or /run/netns/example.
+func NetNSFromPath(path string) (NetNS, error) {
+	ino, err := fileInode(path)
+	if err != nil {
+		return NetNS{}, err
+	}
+	return NetNS{Inode: ino, Path: path}, nil
+}
+
+// ForEachNetNS opens a Diag for every unique network namespace in
+// namespaces and calls fn with it. config is used for every Diag with
+// NetNS set to the respective namespace. The Diag is closed once fn returns.
+// Namespaces the caller is not allowed to enter are skipped. If
+// config.Record is set, all namespaces are recorded into one capture.
+func ForEachNetNS(namespaces []NetNS, config *Config, fn func(ns NetNS, d *Diag) error) error {
+	c := Config{}
+	if config != nil {
+		c = *config
+	}
+	if c.Record != nil && c.capture == nil {
+		c.capture = newCaptureWriter(c.Record)
+	}
+	for _, ns := range uniqueNetNS(namespaces) {
+		if err := withNetNS(ns, c, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueNetNS returns namespaces without duplicates. The Inode of
+// namespaces that only have a Path is looked up. If this fails, they are
+// told apart by Path.
+func uniqueNetNS(namespaces []NetNS) []NetNS {
+	type key struct {
+		inode uint64
+		path  string
+	}
+	seen := make(map[key]struct{}, len(namespaces))
+	unique := make([]NetNS, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if ns.Inode == 0 {
+			if ino, err := fileInode(ns.Path); err == nil {
+				ns.Inode = ino
+			}
+		}
+		k := key{inode: ns.Inode}
+		if ns.Inode == 0 {
+			k.path = ns.Path
+		}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		unique = append(unique, ns)
+	}
+	return unique
+}
+
+// openNetNS opens the Diag of a namespace in withNetNS.
+var openNetNS = Open
+
+func withNetNS(ns NetNS, config Config, fn func(ns NetNS, d *Diag) error) error {
+	f, err := os.Open(ns.Path)
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
+		// The namespace is not accessible or vanished in the meantime.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	config.NetNS = int(f.Fd())
+	config.captureNetNS = ns.Inode
+	d, err := openNetNS(&config)
+	if errors.Is(err, os.ErrPermission) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("network namespace %s: %w", ns.Path, err)
+	}
+	defer d.Close()
+
+	if err := fn(ns, d); err != nil {
+		return fmt.Errorf("network namespace %s: %w", ns.Path, err)
+	}
+	return nil
+}
+
+// NetNSObject is a NetObject tagged with its network namespace.
+type NetNSObject struct {
+	NetNS NetNS
+	NetObject
+}
+
+// UnixNSObject is a UnixObject tagged with its network namespace.
+type UnixNSObject struct {
+	NetNS NetNS
+	UnixObject
+}
+
+// NetDumpAll returns network socket information of all namespaces.
+func NetDumpAll(namespaces []NetNS, config *Config, opt *NetOption) ([]NetNSObject, error) {
+	var results []NetNSObject
+	err := ForEachNetNS(namespaces, config, func(ns NetNS, d *Diag) error {
+		objs, err := d.NetDump(opt)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			results = append(results, NetNSObject{NetNS: ns, NetObject: obj})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// UnixDumpAll returns Unix socket information of all namespaces.
+func UnixDumpAll(namespaces []NetNS, config *Config, opt *UnixOption) ([]UnixNSObject, error) {
+	var results []UnixNSObject
+	err := ForEachNetNS(namespaces, config, func(ns NetNS, d *Diag) error {
+		objs, err := d.UnixDump(opt)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			results = append(results, UnixNSObject{NetNS: ns, UnixObject: obj})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package diag
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+func fileInode(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	return st.Ino, nil
+}
+
+// ListNetNS returns all network namespaces that are named in /run/netns
+// or are in use by a process in /proc. Every namespace is returned once.
+func ListNetNS() ([]NetNS, error) {
+	return listNetNS("/run/netns", "/proc")
+}
+
+func listNetNS(runDir, procDir string) ([]NetNS, error) {
+	var namespaces []NetNS
+	seen := make(map[uint64]struct{})
+	add := func(name, path string) {
+		ino, err := fileInode(path)
+		if err != nil {
+			// Processes come and go and namespaces of other users
+			// might not be accessible.
+			return
+		}
+		if _, ok := seen[ino]; ok {
+			return
+		}
+		seen[ino] = struct{}{}
+		namespaces = append(namespaces, NetNS{Inode: ino, Name: name, Path: path})
+	}
+
+	named, err := os.ReadDir(runDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range named {
+		add(entry.Name(), filepath.Join(runDir, entry.Name()))
+	}
+
+	procs, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range procs {
+		if _, err := strconv.ParseUint(entry.Name(), 10, 32); err != nil {
+			continue
+		}
+		add("", filepath.Join(procDir, entry.Name(), "ns", "net"))
+	}
+	return namespaces, nil
+}
@@ -0,0 +1,80 @@
+package diag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListNetNS(t *testing.T) {
+	root := t.TempDir()
+	runDir := filepath.Join(root, "run")
+	procDir := filepath.Join(root, "proc")
+
+	for _, dir := range []string{
+		runDir,
+		filepath.Join(procDir, "1", "ns"),
+		filepath.Join(procDir, "42", "ns"),
+		filepath.Join(procDir, "self", "ns"),
+	} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(path string) {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(runDir, "blue"))
+	writeFile(filepath.Join(procDir, "1", "ns", "net"))
+	writeFile(filepath.Join(procDir, "self", "ns", "net"))
+	// Process 42 shares the namespace named blue.
+	if err := os.Link(filepath.Join(runDir, "blue"), filepath.Join(procDir, "42", "ns", "net")); err != nil {
+		t.Fatal(err)
+	}
+
+	namespaces, err := listNetNS(runDir, procDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 2 {
+		t.Fatalf("expected 2 namespaces, got %d: %v", len(namespaces), namespaces)
+	}
+	if namespaces[0].Name != "blue" {
+		t.Fatalf("expected named namespace first, got %v", namespaces[0])
+	}
+	if namespaces[1].Path != filepath.Join(procDir, "1", "ns", "net") {
+		t.Fatalf("unexpected namespace %v", namespaces[1])
+	}
+}
+
+func TestUniqueNetNS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"blue", "red"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "blue"), filepath.Join(dir, "blue-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	unique := uniqueNetNS([]NetNS{
+		{Path: filepath.Join(dir, "blue")},
+		{Path: filepath.Join(dir, "red")},
+		{Path: filepath.Join(dir, "blue-link")},
+		{Path: filepath.Join(dir, "missing")},
+		{Path: filepath.Join(dir, "missing")},
+	})
+	var paths []string
+	for _, ns := range unique {
+		paths = append(paths, filepath.Base(ns.Path))
+	}
+	if len(paths) != 3 || paths[0] != "blue" || paths[1] != "red" || paths[2] != "missing" {
+		t.Fatalf("expected [blue red missing], got %v", paths)
+	}
+	if unique[0].Inode == 0 {
+		t.Errorf("expected Inode of blue to be looked up")
+	}
+}
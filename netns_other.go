@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package diag
+
+func fileInode(path string) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+// ListNetNS returns all network namespaces that are named in /run/netns
+// or are in use by a process in /proc. Every namespace is returned once.
+func ListNetNS() ([]NetNS, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,214 @@
+package diag
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Process describes a file descriptor of a process that refers to a socket.
+type Process struct {
+	PID    int    `json:"pid"`
+	Comm   string `json:"comm"`
+	FD     int    `json:"fd"`
+	CGroup string `json:"cgroup,omitempty"`
+}
+
+// procInfo holds information of a process that is shared by its sockets.
+type procInfo struct {
+	// start is the start time of the process in clock ticks after boot,
+	// which tells a reused PID apart.
+	start  uint64
+	comm   string
+	cgroup string
+}
+
+// ProcResolver maps socket inodes to the processes that hold them,
+// similar to ss -p.
+type ProcResolver struct {
+	root string
+
+	mu      sync.RWMutex
+	sockets map[uint32][]Process
+	// procs caches procInfo of the processes seen by the last Refresh.
+	procs map[int]*procInfo
+}
+
+// NewProcResolver returns a ProcResolver that scans /proc.
+// Call Refresh to populate it.
+func NewProcResolver() *ProcResolver {
+	return newProcResolver("/proc")
+}
+
+func newProcResolver(root string) *ProcResolver {
+	return &ProcResolver{
+		root:    root,
+		sockets: make(map[uint32][]Process),
+		procs:   make(map[int]*procInfo),
+	}
+}
+
+// Refresh rescans the file descriptors of all processes. The comm of
+// processes that hold sockets is read again on every Refresh, as it changes
+// with execve. Their cgroup is only read for processes that were not seen
+// by the previous Refresh, identified by PID and start time, so that reused
+// PIDs are detected. Processes that are not accessible are skipped.
+func (r *ProcResolver) Refresh() error {
+	entries, err := os.ReadDir(r.root)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	cached := r.procs
+	r.mu.RUnlock()
+
+	sockets := make(map[uint32][]Process)
+	procs := make(map[int]*procInfo)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join(r.root, entry.Name(), "fd"))
+		if err != nil {
+			// The process terminated or is not accessible.
+			continue
+		}
+		var info *procInfo
+		for _, fd := range fds {
+			ino, ok := r.socketInode(pid, fd.Name())
+			if !ok {
+				continue
+			}
+			if info == nil {
+				var ok bool
+				if info, ok = r.procInfo(pid, cached[pid]); ok {
+					procs[pid] = info
+				}
+			}
+			fdNum, _ := strconv.Atoi(fd.Name())
+			sockets[ino] = append(sockets[ino], Process{
+				PID:    pid,
+				Comm:   info.comm,
+				FD:     fdNum,
+				CGroup: info.cgroup,
+			})
+		}
+	}
+
+	r.mu.Lock()
+	r.sockets = sockets
+	r.procs = procs
+	r.mu.Unlock()
+	return nil
+}
+
+// procInfo returns the procInfo of pid. The cgroup of cached is reused,
+// if it describes the same process. The boolean is false, if the start
+// time of the process is unknown and the result can not be cached.
+func (r *ProcResolver) procInfo(pid int, cached *procInfo) (*procInfo, bool) {
+	dir := filepath.Join(r.root, strconv.Itoa(pid))
+	info := &procInfo{}
+	// stat is empty, if it can not be read.
+	stat, _ := os.ReadFile(filepath.Join(dir, "stat"))
+	var ok bool
+	info.comm, info.start, ok = parseProcStat(string(stat))
+	if !ok {
+		if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+			info.comm = strings.TrimSuffix(string(comm), "\n")
+		}
+	}
+	if ok && cached != nil && cached.start == info.start {
+		info.cgroup = cached.cgroup
+		return info, true
+	}
+	if f, err := os.Open(filepath.Join(dir, "cgroup")); err == nil {
+		info.cgroup = parseProcCGroup(f)
+		f.Close()
+	}
+	return info, ok
+}
+
+// parseProcStat returns comm and start time, field 22, of the content
+// of /proc/<pid>/stat.
+func parseProcStat(stat string) (string, uint64, bool) {
+	// comm is in parentheses and can contain spaces and parentheses.
+	open := strings.IndexByte(stat, '(')
+	closing := strings.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return "", 0, false
+	}
+	// The fields after comm start with field 3, the state.
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 20 {
+		return "", 0, false
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return stat[open+1 : closing], start, true
+}
+
+// parseProcCGroup returns the cgroup v2 path from the content of
+// /proc/<pid>/cgroup. If there is no cgroup v2 entry, the path of the
+// first entry is returned.
+func parseProcCGroup(r io.Reader) string {
+	var first string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Format: hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		if first == "" {
+			first = parts[2]
+		}
+	}
+	return first
+}
+
+func (r *ProcResolver) socketInode(pid int, fd string) (uint32, bool) {
+	link, err := os.Readlink(filepath.Join(r.root, strconv.Itoa(pid), "fd", fd))
+	if err != nil {
+		return 0, false
+	}
+	if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+		return 0, false
+	}
+	ino, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(ino), true
+}
+
+// Lookup returns the processes that hold the socket with the given inode.
+func (r *ProcResolver) Lookup(ino uint32) []Process {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sockets[ino]
+}
+
+// ResolveNet sets Processes of every element of objs.
+func (r *ProcResolver) ResolveNet(objs []NetObject) {
+	for i := range objs {
+		objs[i].Processes = r.Lookup(objs[i].INode)
+	}
+}
+
+// ResolveUnix sets Processes of every element of objs.
+func (r *ProcResolver) ResolveUnix(objs []UnixObject) {
+	for i := range objs {
+		objs[i].Processes = r.Lookup(objs[i].Ino)
+	}
+}
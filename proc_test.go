@@ -0,0 +1,131 @@
+package diag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcResolver(t *testing.T) {
+	root := t.TempDir()
+	pidDir := filepath.Join(root, "1234")
+	if err := os.MkdirAll(filepath.Join(pidDir, "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pidDir, "comm"), []byte("nginx\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cgroup := "1:name=systemd:/legacy\n0::/system.slice/nginx.service\n"
+	if err := os.WriteFile(filepath.Join(pidDir, "cgroup"), []byte(cgroup), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for fd, target := range map[string]string{
+		"0": "/dev/null",
+		"3": "socket:[4711]",
+		"7": "pipe:[99]",
+	} {
+		if err := os.Symlink(target, filepath.Join(pidDir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := newProcResolver(root)
+	if err := r.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	objs := []NetObject{{DiagMsg: DiagMsg{INode: 4711}}, {DiagMsg: DiagMsg{INode: 99}}}
+	r.ResolveNet(objs)
+	if len(objs[1].Processes) != 0 {
+		t.Fatalf("unexpected processes for inode 99: %v", objs[1].Processes)
+	}
+	procs := objs[0].Processes
+	if len(procs) != 1 {
+		t.Fatalf("expected 1 process, got %d", len(procs))
+	}
+	expected := Process{PID: 1234, Comm: "nginx", FD: 3, CGroup: "/system.slice/nginx.service"}
+	if procs[0] != expected {
+		t.Fatalf("expected %v, got %v", expected, procs[0])
+	}
+}
+
+// writeProcStat writes /proc/<pid>/stat with comm and start time.
+func writeProcStat(t *testing.T, pidDir, comm string, start uint64) {
+	t.Helper()
+	fields := make([]string, 19)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	stat := fmt.Sprintf("%s (%s) S %s %d 0\n", filepath.Base(pidDir), comm,
+		strings.Join(fields[1:], " "), start)
+	if err := os.WriteFile(filepath.Join(pidDir, "stat"), []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcResolverRefreshComm(t *testing.T) {
+	root := t.TempDir()
+	pidDir := filepath.Join(root, "1234")
+	if err := os.MkdirAll(filepath.Join(pidDir, "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("socket:[4711]", filepath.Join(pidDir, "fd", "3")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newProcResolver(root)
+	// The process calls execve between the refreshes.
+	for _, comm := range []string{"sh", "nginx"} {
+		writeProcStat(t, pidDir, comm, 100)
+		if err := r.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		procs := r.Lookup(4711)
+		if len(procs) != 1 || procs[0].Comm != comm {
+			t.Fatalf("expected comm %s, got %v", comm, procs)
+		}
+	}
+}
+
+func TestProcResolverCache(t *testing.T) {
+	root := t.TempDir()
+	pidDir := filepath.Join(root, "1234")
+	if err := os.MkdirAll(filepath.Join(pidDir, "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("socket:[4711]", filepath.Join(pidDir, "fd", "3")); err != nil {
+		t.Fatal(err)
+	}
+	writeCGroup := func(path string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(pidDir, "cgroup"), []byte("0::"+path+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := newProcResolver(root)
+	for _, test := range []struct {
+		name     string
+		start    uint64
+		cgroup   string
+		expected string
+	}{
+		{name: "first", start: 100, cgroup: "/a", expected: "/a"},
+		// The process is unchanged, so its cgroup is not read again.
+		{name: "unchanged", start: 100, cgroup: "/b", expected: "/a"},
+		// The PID was reused by a new process.
+		{name: "reused", start: 200, cgroup: "/c", expected: "/c"},
+	} {
+		writeProcStat(t, pidDir, "my (app)", test.start)
+		writeCGroup(test.cgroup)
+		if err := r.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		procs := r.Lookup(4711)
+		if len(procs) != 1 || procs[0].CGroup != test.expected || procs[0].Comm != "my (app)" {
+			t.Fatalf("%s: expected cgroup %s, got %v", test.name, test.expected, procs)
+		}
+	}
+}
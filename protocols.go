@@ -1,153 +1,327 @@
 package diag
 
 import (
+	"fmt"
+	"reflect"
+
 	"github.com/florianl/go-diag/internal/unix"
+	"github.com/mdlayher/netlink"
 )
 
 // TcpInfo based on tcp_info in include/uapi/linux/tcp.h
 type TcpInfo struct {
-	State       uint8
-	CaState     uint8
-	Retransmits uint8
-	Probes      uint8
-	Backoff     uint8
-	Options     uint8
-	Wscale      uint8 // snd: 4, rcv : 4;
-	ClientInfo  uint8 // DeliveryRateAppLimited:1, FastopenClientFail:2;
-
-	Rto    uint32
-	Ato    uint32
-	SndMss uint32
-	RcvMss uint32
-
-	Unacked uint32
-	Sacked  uint32
-	Lost    uint32
-	Retrans uint32
-	Fackets uint32
-
-	LastDataSent uint32
-	LastAckSent  uint32
-	LastDataRecv uint32
-	LastAckRecv  uint32
-
-	Pmtu        uint32
-	RcvSsthresh uint32
-	Rtt         uint32
-	Rttvar      uint32
-	SndSsthresh uint32
-	SndCwnd     uint32
-	Advmss      uint32
-	Reordering  uint32
-
-	RcvRtt   uint32
-	RcvSpace uint32
-
-	RotalRetrans uint32
-
-	PacingRate    uint64
-	MaxPacingRate uint64
-	BytesAcked    uint64
-	BytesReceived uint64
-	SegsOut       uint32
-	SegsIn        uint32
-
-	NotsentBytes uint32
-	MinRtt       uint32
-	DataSegsIn   uint32
-	DataSegsOut  uint32
-
-	DeliveryRate uint64
-
-	BusyTime      uint64
-	RwndLimited   uint64
-	SndbufLimited uint64
-
-	Delivered   uint32
-	DeliveredCe uint32
-
-	BytesSent    uint64
-	BytesRetrans uint64
-	DsackDups    uint32
-	ReordSeen    uint32
-
-	RcvOoopack uint32
-
-	SndWnd uint32
-	RcvWnd uint32
-
-	Rehash uint32
-
-	TotalRto           uint16
-	TotalRtoRecoveries uint16
-	TotalRtoTime       uint32
+	State       uint8 `json:"state"`
+	CaState     uint8 `json:"ca_state"`
+	Retransmits uint8 `json:"retransmits"`
+	Probes      uint8 `json:"probes"`
+	Backoff     uint8 `json:"backoff"`
+	Options     uint8 `json:"options"`
+	Wscale      uint8 `json:"wscale"`      // snd: 4, rcv : 4;
+	ClientInfo  uint8 `json:"client_info"` // DeliveryRateAppLimited:1, FastopenClientFail:2;
+
+	Rto    uint32 `json:"rto_us"`
+	Ato    uint32 `json:"ato_us"`
+	SndMss uint32 `json:"snd_mss"`
+	RcvMss uint32 `json:"rcv_mss"`
+
+	Unacked uint32 `json:"unacked"`
+	Sacked  uint32 `json:"sacked"`
+	Lost    uint32 `json:"lost"`
+	Retrans uint32 `json:"retrans"`
+	Fackets uint32 `json:"fackets"`
+
+	LastDataSent uint32 `json:"last_data_sent_ms"`
+	LastAckSent  uint32 `json:"last_ack_sent_ms"`
+	LastDataRecv uint32 `json:"last_data_recv_ms"`
+	LastAckRecv  uint32 `json:"last_ack_recv_ms"`
+
+	Pmtu        uint32 `json:"pmtu"`
+	RcvSsthresh uint32 `json:"rcv_ssthresh"`
+	Rtt         uint32 `json:"rtt_us"`
+	Rttvar      uint32 `json:"rttvar_us"`
+	SndSsthresh uint32 `json:"snd_ssthresh"`
+	SndCwnd     uint32 `json:"snd_cwnd"`
+	Advmss      uint32 `json:"advmss"`
+	Reordering  uint32 `json:"reordering"`
+
+	RcvRtt   uint32 `json:"rcv_rtt_us"`
+	RcvSpace uint32 `json:"rcv_space"`
+
+	RotalRetrans uint32 `json:"total_retrans"`
+
+	PacingRate    uint64 `json:"pacing_rate"`
+	MaxPacingRate uint64 `json:"max_pacing_rate"`
+	BytesAcked    uint64 `json:"bytes_acked"`
+	BytesReceived uint64 `json:"bytes_received"`
+	SegsOut       uint32 `json:"segs_out"`
+	SegsIn        uint32 `json:"segs_in"`
+
+	NotsentBytes uint32 `json:"notsent_bytes"`
+	MinRtt       uint32 `json:"min_rtt_us"`
+	DataSegsIn   uint32 `json:"data_segs_in"`
+	DataSegsOut  uint32 `json:"data_segs_out"`
+
+	DeliveryRate uint64 `json:"delivery_rate"`
+
+	BusyTime      uint64 `json:"busy_time_us"`
+	RwndLimited   uint64 `json:"rwnd_limited_us"`
+	SndbufLimited uint64 `json:"sndbuf_limited_us"`
+
+	Delivered   uint32 `json:"delivered"`
+	DeliveredCe uint32 `json:"delivered_ce"`
+
+	BytesSent    uint64 `json:"bytes_sent"`
+	BytesRetrans uint64 `json:"bytes_retrans"`
+	DsackDups    uint32 `json:"dsack_dups"`
+	ReordSeen    uint32 `json:"reord_seen"`
+
+	RcvOoopack uint32 `json:"rcv_ooopack"`
+
+	SndWnd uint32 `json:"snd_wnd"`
+	RcvWnd uint32 `json:"rcv_wnd"`
+
+	Rehash uint32 `json:"rehash"`
+
+	TotalRto           uint16 `json:"total_rto"`
+	TotalRtoRecoveries uint16 `json:"total_rto_recoveries"`
+	TotalRtoTime       uint32 `json:"total_rto_time_ms"`
+
+	ReceivedCe uint32 `json:"received_ce"`
+
+	DeliveredE1Bytes uint32 `json:"delivered_e1_bytes"`
+	DeliveredE0Bytes uint32 `json:"delivered_e0_bytes"`
+	DeliveredCeBytes uint32 `json:"delivered_ce_bytes"`
+	ReceivedE1Bytes  uint32 `json:"received_e1_bytes"`
+	ReceivedE0Bytes  uint32 `json:"received_e0_bytes"`
+	ReceivedCeBytes  uint32 `json:"received_ce_bytes"`
+	AccecnFailMode   uint16 `json:"accecn_fail_mode"`
+	AccecnOptSeen    uint16 `json:"accecn_opt_seen"`
+}
+
+// tcpInfoFieldEnd maps the name of a TcpInfo field to the offset
+// of the first byte after this field in tcp_info.
+var tcpInfoFieldEnd = func() map[string]int {
+	typ := reflect.TypeOf(TcpInfo{})
+	ends := make(map[string]int, typ.NumField())
+	offset := 0
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		offset += int(field.Type.Size())
+		ends[field.Name] = offset
+	}
+	return ends
+}()
+
+// TcpInfoHas reports whether the field of TcpInfo with the given name
+// was reported by the kernel. Older kernels provide a shorter tcp_info and
+// fields that were not reported are left zero in TcpInfo. TcpInfoHas
+// panics, if TcpInfo has no field with the given name.
+func (a *NetAttribute) TcpInfoHas(field string) bool {
+	end, ok := tcpInfoFieldEnd[field]
+	if !ok {
+		panic(fmt.Sprintf("diag: TcpInfo has no field %q", field))
+	}
+	if a.TcpInfo == nil {
+		return false
+	}
+	return end <= a.InfoLen
+}
+
+// Flags of TcpInfo.Options based on TCPI_OPT_* in include/uapi/linux/tcp.h
+const (
+	TcpiOptTimestamps = 1 << iota
+	TcpiOptSACK
+	TcpiOptWscale
+	TcpiOptECN
+	TcpiOptECNSeen
+	TcpiOptSYNData
+	TcpiOptUSecTS
+	TcpiOptTFOChild
+)
+
+// CAState represents the congestion avoidance state of a TCP socket.
+type CAState uint8
+
+// Based on tcp_ca_state in include/uapi/linux/tcp.h
+const (
+	CAOpen CAState = iota
+	CADisorder
+	CACWR
+	CARecovery
+	CALoss
+)
+
+func (s CAState) String() string {
+	switch s {
+	case CAOpen:
+		return "open"
+	case CADisorder:
+		return "disorder"
+	case CACWR:
+		return "cwr"
+	case CARecovery:
+		return "recovery"
+	case CALoss:
+		return "loss"
+	}
+	return fmt.Sprintf("CAState(%d)", uint8(s))
+}
+
+// FastOpenFail describes why a TCP Fast Open attempt of a client failed.
+type FastOpenFail uint8
+
+// Based on tcp_fastopen_client_fail in include/uapi/linux/tcp.h
+const (
+	TFOStatusUnspec FastOpenFail = iota
+	TFOCookieUnavailable
+	TFODataNotAcked
+	TFOSynRetransmitted
+)
+
+func (f FastOpenFail) String() string {
+	switch f {
+	case TFOStatusUnspec:
+		return "unspec"
+	case TFOCookieUnavailable:
+		return "cookie-unavailable"
+	case TFODataNotAcked:
+		return "data-not-acked"
+	case TFOSynRetransmitted:
+		return "syn-retransmitted"
+	}
+	return fmt.Sprintf("FastOpenFail(%d)", uint8(f))
+}
+
+// CongestionState returns the congestion avoidance state.
+func (t *TcpInfo) CongestionState() CAState {
+	return CAState(t.CaState)
+}
+
+// SndWscale returns the window scale factor of the send direction.
+func (t *TcpInfo) SndWscale() uint8 {
+	return t.Wscale & 0x0F
+}
+
+// RcvWscale returns the window scale factor of the receive direction.
+func (t *TcpInfo) RcvWscale() uint8 {
+	return t.Wscale >> 4
+}
+
+// DeliveryRateAppLimited reports whether DeliveryRate was limited by the application.
+func (t *TcpInfo) DeliveryRateAppLimited() bool {
+	return t.ClientInfo&0x01 != 0
+}
+
+// FastOpenClientFail returns the reason a TCP Fast Open attempt failed.
+func (t *TcpInfo) FastOpenClientFail() FastOpenFail {
+	return FastOpenFail((t.ClientInfo >> 1) & 0x03)
+}
+
+// HasTimestamps reports whether TCP timestamps are negotiated.
+func (t *TcpInfo) HasTimestamps() bool {
+	return t.Options&TcpiOptTimestamps != 0
+}
+
+// HasSACK reports whether selective acknowledgements are negotiated.
+func (t *TcpInfo) HasSACK() bool {
+	return t.Options&TcpiOptSACK != 0
+}
+
+// HasWscale reports whether window scaling is negotiated.
+func (t *TcpInfo) HasWscale() bool {
+	return t.Options&TcpiOptWscale != 0
+}
+
+// HasECN reports whether ECN is negotiated.
+func (t *TcpInfo) HasECN() bool {
+	return t.Options&TcpiOptECN != 0
+}
+
+// ECNSeen reports whether at least one packet with ECT was received.
+func (t *TcpInfo) ECNSeen() bool {
+	return t.Options&TcpiOptECNSeen != 0
+}
+
+// SYNData reports whether data in the SYN was acknowledged by the peer.
+func (t *TcpInfo) SYNData() bool {
+	return t.Options&TcpiOptSYNData != 0
+}
+
+// USecTS reports whether timestamps use microsecond resolution.
+func (t *TcpInfo) USecTS() bool {
+	return t.Options&TcpiOptUSecTS != 0
+}
+
+// TFOChild reports whether the socket was created by a TCP Fast Open server.
+func (t *TcpInfo) TFOChild() bool {
+	return t.Options&TcpiOptTFOChild != 0
 }
 
 // Based on __kernel_sockaddr_storage in include/uapi/linux/socket.h
 type KernelSockaddrStorage struct {
-	Family uint16
-	Data   [126]byte
+	Family uint16    `json:"family"`
+	Data   [126]byte `json:"data"`
 }
 
 type SctpInfo struct {
-	Tag                uint32
-	State              uint32
-	Rwnd               uint32
-	Unackdata          uint16
-	Penddata           uint16
-	Instrms            uint16
-	Outstrms           uint16
-	FragmentationPoint uint32
-	Inqueue            uint32
-	Outqueue           uint32
-	OverallError       uint32
-	MaxBurst           uint32
-	Maxseg             uint32
-	PeerRwnd           uint32
-	PeerTag            uint32
-	PeerCapable        uint8
-	PeerSack           uint8
-	Reserved1          uint16
-
-	Isacks       uint64
-	Osacks       uint64
-	Opackets     uint64
-	Ipackets     uint64
-	Rtxchunks    uint64
-	Outofseqtsns uint64
-	Idupchunks   uint64
-	Gapcnt       uint64
-	Ouodchunks   uint64
-	Iuodchunks   uint64
-	Oodchunks    uint64
-	Iodchunks    uint64
-	Octrlchunks  uint64
-	Ictrlchunks  uint64
-
-	SockaddrStorage      KernelSockaddrStorage
-	PState               int32
-	PCwnd                uint32
-	PSrtt                uint32
-	PRto                 uint32
-	PHbinterval          uint32
-	PPathmaxrxt          uint32
-	PSackdelay           uint32
-	PSackfreq            uint32
-	PSsthresh            uint32
-	PPartial_bytes_acked uint32
-	PFlight_size         uint32
-	PError               uint16
-	Reserved2            uint16
-
-	SAutoclose        uint32
-	SAdaptation_ind   uint32
-	SPdPoint          uint32
-	SNodelay          uint8
-	SDisableFragments uint8
-	Sv4mapped         uint8
-	SFragInterleave   uint8
-	SType             uint32
-	Reserved3         uint32
+	Tag                uint32 `json:"tag"`
+	State              uint32 `json:"state"`
+	Rwnd               uint32 `json:"rwnd"`
+	Unackdata          uint16 `json:"unackdata"`
+	Penddata           uint16 `json:"penddata"`
+	Instrms            uint16 `json:"instrms"`
+	Outstrms           uint16 `json:"outstrms"`
+	FragmentationPoint uint32 `json:"fragmentation_point"`
+	Inqueue            uint32 `json:"inqueue"`
+	Outqueue           uint32 `json:"outqueue"`
+	OverallError       uint32 `json:"overall_error"`
+	MaxBurst           uint32 `json:"max_burst"`
+	Maxseg             uint32 `json:"maxseg"`
+	PeerRwnd           uint32 `json:"peer_rwnd"`
+	PeerTag            uint32 `json:"peer_tag"`
+	PeerCapable        uint8  `json:"peer_capable"`
+	PeerSack           uint8  `json:"peer_sack"`
+	Reserved1          uint16 `json:"-"`
+
+	Isacks       uint64 `json:"isacks"`
+	Osacks       uint64 `json:"osacks"`
+	Opackets     uint64 `json:"opackets"`
+	Ipackets     uint64 `json:"ipackets"`
+	Rtxchunks    uint64 `json:"rtxchunks"`
+	Outofseqtsns uint64 `json:"outofseqtsns"`
+	Idupchunks   uint64 `json:"idupchunks"`
+	Gapcnt       uint64 `json:"gapcnt"`
+	Ouodchunks   uint64 `json:"ouodchunks"`
+	Iuodchunks   uint64 `json:"iuodchunks"`
+	Oodchunks    uint64 `json:"oodchunks"`
+	Iodchunks    uint64 `json:"iodchunks"`
+	Octrlchunks  uint64 `json:"octrlchunks"`
+	Ictrlchunks  uint64 `json:"ictrlchunks"`
+
+	SockaddrStorage      KernelSockaddrStorage `json:"sockaddr_storage"`
+	PState               int32                 `json:"p_state"`
+	PCwnd                uint32                `json:"p_cwnd"`
+	PSrtt                uint32                `json:"p_srtt"`
+	PRto                 uint32                `json:"p_rto"`
+	PHbinterval          uint32                `json:"p_hbinterval"`
+	PPathmaxrxt          uint32                `json:"p_pathmaxrxt"`
+	PSackdelay           uint32                `json:"p_sackdelay"`
+	PSackfreq            uint32                `json:"p_sackfreq"`
+	PSsthresh            uint32                `json:"p_ssthresh"`
+	PPartial_bytes_acked uint32                `json:"p_partial_bytes_acked"`
+	PFlight_size         uint32                `json:"p_flight_size"`
+	PError               uint16                `json:"p_error"`
+	Reserved2            uint16                `json:"-"`
+
+	SAutoclose        uint32 `json:"s_autoclose"`
+	SAdaptation_ind   uint32 `json:"s_adaptation_ind"`
+	SPdPoint          uint32 `json:"s_pd_point"`
+	SNodelay          uint8  `json:"s_nodelay"`
+	SDisableFragments uint8  `json:"s_disable_fragments"`
+	Sv4mapped         uint8  `json:"s_v4mapped"`
+	SFragInterleave   uint8  `json:"s_frag_interleave"`
+	SType             uint32 `json:"s_type"`
+	Reserved3         uint32 `json:"-"`
 }
 
 // NetOption defines a query to network sockets.
@@ -157,23 +331,108 @@ type NetOption struct {
 	Ext      uint8
 	State    uint32
 	ID       SockID
+
+	// RawProtocol selects the protocol of raw sockets, if Protocol
+	// is IPPROTO_RAW. IPPROTO_RAW selects raw sockets of all protocols.
+	RawProtocol uint8
+
+	// Filter restricts the returned sockets further. Top-level state
+	// predicates of Filter are combined with State.
+	Filter *Filter
 }
 
-// NetDump returns network socket information.
-func (d *Diag) NetDump(opt *NetOption) ([]NetObject, error) {
-	header := InetDiagReqV2{
+func (opt *NetOption) header() InetDiagReqV2 {
+	return InetDiagReqV2{
 		Family:   opt.Family,
 		Protocol: opt.Protocol,
 		Ext:      opt.Ext,
+		Pad:      opt.RawProtocol,
 		States:   opt.State,
 		ID:       opt.ID,
 	}
+}
 
-	respMsgs, err := d.dumpQuery(header)
+// NetDump returns network socket information.
+func (d *Diag) NetDump(opt *NetOption) ([]NetObject, error) {
+	respMsgs, err := d.netQuery(opt)
 	if err != nil {
 		return nil, err
 	}
-	return handleNetResponse(respMsgs, d.skipOptional)
+	objs, err := handleNetResponse(respMsgs, d.decode)
+	if err != nil || opt.Filter == nil || len(opt.Filter.local) == 0 {
+		return objs, err
+	}
+	filtered := objs[:0]
+	for i := range objs {
+		if opt.Filter.matchLocal(&objs[i]) {
+			filtered = append(filtered, objs[i])
+		}
+	}
+	return filtered, nil
+}
+
+// NetDumpFunc calls fn for every socket of opt like NetDump, but decodes
+// all sockets into the same NetObject with a NetDecoder. obj is only valid
+// until fn returns. An error of fn stops the iteration and is returned.
+func (d *Diag) NetDumpFunc(opt *NetOption, fn func(obj *NetObject) error) error {
+	respMsgs, err := d.netQuery(opt)
+	if err != nil {
+		return err
+	}
+	dec := NetDecoder{opts: d.decode}
+	var obj NetObject
+	for i, msg := range respMsgs {
+		dec.opts.index = i
+		if err := dec.Decode(msg.Data, &obj); err != nil {
+			return withIndex(err, i)
+		}
+		if opt.Filter != nil && !opt.Filter.matchLocal(&obj) {
+			continue
+		}
+		if err := fn(&obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// netQuery sends the dump request of opt, including its Filter.
+func (d *Diag) netQuery(opt *NetOption) ([]netlink.Message, error) {
+	header := opt.header()
+	var attrs []byte
+	if opt.Filter != nil {
+		header.States &= opt.Filter.states
+		if len(opt.Filter.kernel) != 0 {
+			ae := netlink.NewAttributeEncoder()
+			ae.Bytes(inetDiagReqBytecode, opt.Filter.kernel)
+			var err error
+			if attrs, err = ae.Encode(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d.dumpQuery(header, attrs)
+}
+
+// NetDestroy closes the socket identified by opt.ID, including its cookie.
+// It requires CAP_NET_ADMIN and a kernel built with CONFIG_INET_DIAG_DESTROY.
+func (d *Diag) NetDestroy(opt *NetOption) error {
+	data, err := marshalStruct(opt.header())
+	if err != nil {
+		return err
+	}
+
+	req := netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(unix.SOCK_DESTROY),
+			Flags: netlink.Request | netlink.Acknowledge,
+		},
+		Data: data,
+	}
+	if _, err := d.con.Execute(req); err != nil {
+		return netlinkError(err)
+	}
+	return nil
 }
 
 // Dump returns all TCP connections.
@@ -0,0 +1,62 @@
+package diag
+
+import "testing"
+
+func TestTcpInfoAccessors(t *testing.T) {
+	info := TcpInfo{
+		CaState:    3,
+		Options:    TcpiOptSACK | TcpiOptTimestamps | TcpiOptECNSeen,
+		Wscale:     0x97,
+		ClientInfo: 0x05,
+	}
+
+	if got := info.SndWscale(); got != 7 {
+		t.Fatalf("SndWscale: expected 7, got %d", got)
+	}
+	if got := info.RcvWscale(); got != 9 {
+		t.Fatalf("RcvWscale: expected 9, got %d", got)
+	}
+	if !info.HasSACK() || !info.HasTimestamps() || !info.ECNSeen() {
+		t.Fatalf("expected SACK, timestamps and ECN seen to be set")
+	}
+	if info.HasECN() || info.HasWscale() || info.SYNData() || info.USecTS() || info.TFOChild() {
+		t.Fatalf("unexpected option flag set in 0x%x", info.Options)
+	}
+	if !info.DeliveryRateAppLimited() {
+		t.Fatalf("expected delivery rate to be app limited")
+	}
+	if got := info.FastOpenClientFail(); got != TFODataNotAcked {
+		t.Fatalf("FastOpenClientFail: expected %v, got %v", TFODataNotAcked, got)
+	}
+	if got := info.CongestionState(); got != CARecovery || got.String() != "recovery" {
+		t.Fatalf("CongestionState: expected recovery, got %v", got)
+	}
+}
+
+func TestTcpInfoHas(t *testing.T) {
+	// Linux 4.19 reports tcp_info up to and including tcpi_reord_seen.
+	attr := NetAttribute{
+		TcpInfo: &TcpInfo{},
+		InfoLen: 224,
+	}
+
+	for field, expected := range map[string]bool{
+		"State":        true,
+		"BytesRetrans": true,
+		"DsackDups":    true,
+		"ReordSeen":    true,
+		"RcvOoopack":   false,
+		"TotalRtoTime": false,
+	} {
+		if got := attr.TcpInfoHas(field); got != expected {
+			t.Errorf("TcpInfoHas(%q): expected %v, got %v", field, expected, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic for unknown field")
+		}
+	}()
+	attr.TcpInfoHas("Unknown")
+}
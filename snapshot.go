@@ -0,0 +1,182 @@
+package diag
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot holds network sockets at a point in time, keyed by their cookie.
+type Snapshot struct {
+	Time    time.Time
+	Sockets map[uint64]NetObject
+}
+
+// NewSnapshot returns a Snapshot of objs taken at t.
+func NewSnapshot(t time.Time, objs []NetObject) *Snapshot {
+	s := &Snapshot{
+		Time:    t,
+		Sockets: make(map[uint64]NetObject, len(objs)),
+	}
+	for _, obj := range objs {
+		s.Sockets[obj.ID.CookieValue()] = obj
+	}
+	return s
+}
+
+// TcpCounters holds the cumulative counters of TcpInfo, which are compared
+// between snapshots.
+type TcpCounters struct {
+	BytesAcked    uint64
+	BytesReceived uint64
+	SegsOut       uint64
+	TotalRetrans  uint64
+	Delivered     uint64
+}
+
+func tcpCounters(info *TcpInfo) TcpCounters {
+	if info == nil {
+		return TcpCounters{}
+	}
+	return TcpCounters{
+		BytesAcked:    info.BytesAcked,
+		BytesReceived: info.BytesReceived,
+		SegsOut:       uint64(info.SegsOut),
+		TotalRetrans:  uint64(info.RotalRetrans),
+		Delivered:     uint64(info.Delivered),
+	}
+}
+
+// sub returns c - prev. SegsOut, TotalRetrans and Delivered are 32 bits
+// wide in tcp_info and wrap around on long-lived connections, so they are
+// subtracted modulo 2^32. If a 64 bit counter went backwards, the counters
+// were reset and c is returned as delta.
+func (c TcpCounters) sub(prev TcpCounters) (TcpCounters, bool) {
+	if c.BytesAcked < prev.BytesAcked || c.BytesReceived < prev.BytesReceived {
+		return c, true
+	}
+	return TcpCounters{
+		BytesAcked:    c.BytesAcked - prev.BytesAcked,
+		BytesReceived: c.BytesReceived - prev.BytesReceived,
+		SegsOut:       sub32(c.SegsOut, prev.SegsOut),
+		TotalRetrans:  sub32(c.TotalRetrans, prev.TotalRetrans),
+		Delivered:     sub32(c.Delivered, prev.Delivered),
+	}, false
+}
+
+// sub32 returns cur - prev of a 32 bit counter, that may have wrapped.
+func sub32(cur, prev uint64) uint64 {
+	return uint64(uint32(cur) - uint32(prev))
+}
+
+// TcpRates holds the rates of TcpCounters per second.
+type TcpRates struct {
+	BytesAcked    float64
+	BytesReceived float64
+	SegsOut       float64
+	TotalRetrans  float64
+	Delivered     float64
+}
+
+// PerSecond returns the rates of c over the interval d.
+func (c TcpCounters) PerSecond(d time.Duration) TcpRates {
+	if d <= 0 {
+		return TcpRates{}
+	}
+	secs := d.Seconds()
+	return TcpRates{
+		BytesAcked:    float64(c.BytesAcked) / secs,
+		BytesReceived: float64(c.BytesReceived) / secs,
+		SegsOut:       float64(c.SegsOut) / secs,
+		TotalRetrans:  float64(c.TotalRetrans) / secs,
+		Delivered:     float64(c.Delivered) / secs,
+	}
+}
+
+// SocketChange describes a socket that is part of two snapshots.
+type SocketChange struct {
+	Prev NetObject
+	Cur  NetObject
+
+	// Delta holds the growth of the TcpInfo counters between the
+	// snapshots and Rate the corresponding rates.
+	Delta TcpCounters
+	Rate  TcpRates
+
+	// Reset is set, if BytesAcked or BytesReceived went backwards. Delta
+	// then holds the counters of Cur like for a new socket.
+	Reset bool
+}
+
+// StateChanged reports whether the state of the socket changed.
+func (c *SocketChange) StateChanged() bool {
+	return c.Prev.State != c.Cur.State
+}
+
+// SnapshotDiff is the difference between two snapshots.
+type SnapshotDiff struct {
+	Interval time.Duration
+
+	// Opened and Closed hold the sockets that are only part of the
+	// current or previous snapshot respectively.
+	Opened []NetObject
+	Closed []NetObject
+
+	// Changed holds the sockets of both snapshots whose state, queues
+	// or TcpInfo counters changed.
+	Changed []SocketChange
+}
+
+// Diff compares the snapshots prev and cur. prev may be nil, in which case
+// all sockets of cur are reported as opened. Elements of the result are
+// ordered by cookie.
+//
+// A cookie that is reused by a socket with a different address or port is
+// reported as closed and opened socket.
+func Diff(prev, cur *Snapshot) *SnapshotDiff {
+	if prev == nil {
+		prev = &Snapshot{Time: cur.Time}
+	}
+	diff := &SnapshotDiff{Interval: cur.Time.Sub(prev.Time)}
+
+	for _, cookie := range sortedCookies(cur.Sockets) {
+		obj := cur.Sockets[cookie]
+		old, ok := prev.Sockets[cookie]
+		if !ok || !sameSocket(&old, &obj) {
+			diff.Opened = append(diff.Opened, obj)
+			continue
+		}
+
+		change := SocketChange{Prev: old, Cur: obj}
+		change.Delta, change.Reset = tcpCounters(obj.TcpInfo).sub(tcpCounters(old.TcpInfo))
+		change.Rate = change.Delta.PerSecond(diff.Interval)
+		if change.Delta != (TcpCounters{}) || old.State != obj.State ||
+			old.RQueue != obj.RQueue || old.WQueue != obj.WQueue {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	for _, cookie := range sortedCookies(prev.Sockets) {
+		old := prev.Sockets[cookie]
+		obj, ok := cur.Sockets[cookie]
+		if ok && sameSocket(&old, &obj) {
+			continue
+		}
+		diff.Closed = append(diff.Closed, old)
+	}
+	return diff
+}
+
+// sameSocket reports whether a and b share the address and ports.
+func sameSocket(a, b *NetObject) bool {
+	return a.Family == b.Family && a.ID.SPort == b.ID.SPort && a.ID.DPort == b.ID.DPort &&
+		a.ID.Src == b.ID.Src && a.ID.Dst == b.ID.Dst
+}
+
+func sortedCookies(sockets map[uint64]NetObject) []uint64 {
+	cookies := make([]uint64, 0, len(sockets))
+	for cookie := range sockets {
+		cookies = append(cookies, cookie)
+	}
+	sort.Slice(cookies, func(i, j int) bool { return cookies[i] < cookies[j] })
+	return cookies
+}
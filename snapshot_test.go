@@ -0,0 +1,101 @@
+package diag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestDiff(t *testing.T) {
+	withInfo := func(obj NetObject, cookie uint32, info TcpInfo) NetObject {
+		obj.ID.Cookie[0] = cookie
+		obj.TcpInfo = &info
+		return obj
+	}
+	established := testSocket(unix.AF_INET, "10.0.0.1:443", "192.0.2.1:50000", StateEstablished)
+	other := testSocket(unix.AF_INET, "10.0.0.1:443", "192.0.2.2:50000", StateEstablished)
+
+	start := time.Unix(1000, 0)
+	prev := NewSnapshot(start, []NetObject{
+		withInfo(established, 1, TcpInfo{BytesAcked: 1000, BytesReceived: 500, SegsOut: 10}),
+		withInfo(established, 2, TcpInfo{BytesAcked: 1000}),
+		withInfo(established, 3, TcpInfo{BytesAcked: 1000, Delivered: 5}),
+		withInfo(established, 4, TcpInfo{}),
+		withInfo(established, 5, TcpInfo{}),
+	})
+	cur := NewSnapshot(start.Add(2*time.Second), []NetObject{
+		withInfo(established, 1, TcpInfo{BytesAcked: 3000, BytesReceived: 1500, SegsOut: 20, RotalRetrans: 2}),
+		withInfo(established, 2, TcpInfo{BytesAcked: 1000}),
+		withInfo(established, 3, TcpInfo{BytesAcked: 200}),
+		withInfo(other, 4, TcpInfo{}),
+		withInfo(established, 6, TcpInfo{}),
+	})
+
+	diff := Diff(prev, cur)
+	if diff.Interval != 2*time.Second {
+		t.Fatalf("Interval: expected 2s, got %v", diff.Interval)
+	}
+
+	cookies := func(objs []NetObject) []uint32 {
+		var out []uint32
+		for _, obj := range objs {
+			out = append(out, obj.ID.Cookie[0])
+		}
+		return out
+	}
+	if got := cookies(diff.Opened); len(got) != 2 || got[0] != 4 || got[1] != 6 {
+		t.Errorf("Opened: expected [4 6], got %v", got)
+	}
+	if got := cookies(diff.Closed); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("Closed: expected [4 5], got %v", got)
+	}
+
+	if len(diff.Changed) != 2 {
+		t.Fatalf("Changed: expected 2 sockets, got %d", len(diff.Changed))
+	}
+	c := diff.Changed[0]
+	expected := TcpCounters{BytesAcked: 2000, BytesReceived: 1000, SegsOut: 10, TotalRetrans: 2}
+	if c.Cur.ID.Cookie[0] != 1 || c.Reset || c.Delta != expected {
+		t.Errorf("Changed[0]: unexpected %+v", c)
+	}
+	if c.Rate.BytesAcked != 1000 || c.Rate.BytesReceived != 500 {
+		t.Errorf("Changed[0]: unexpected rate %+v", c.Rate)
+	}
+	c = diff.Changed[1]
+	if c.Cur.ID.Cookie[0] != 3 || !c.Reset || c.Delta.BytesAcked != 200 {
+		t.Errorf("Changed[1]: unexpected %+v", c)
+	}
+
+	diff = Diff(nil, cur)
+	if len(diff.Opened) != len(cur.Sockets) || diff.Interval != 0 {
+		t.Errorf("Diff(nil, cur): unexpected %+v", diff)
+	}
+}
+
+func TestDiffCounterWrap(t *testing.T) {
+	obj := testSocket(unix.AF_INET, "10.0.0.1:443", "192.0.2.1:50000", StateEstablished)
+	withInfo := func(info TcpInfo) NetObject {
+		obj := obj
+		obj.TcpInfo = &info
+		return obj
+	}
+
+	start := time.Unix(1000, 0)
+	prev := NewSnapshot(start, []NetObject{withInfo(TcpInfo{
+		BytesAcked: 1 << 40, SegsOut: 0xfffffff0, RotalRetrans: 100, Delivered: 0xffffffff,
+	})})
+	cur := NewSnapshot(start.Add(time.Second), []NetObject{withInfo(TcpInfo{
+		BytesAcked: 1<<40 + 1000, SegsOut: 0x10, RotalRetrans: 100, Delivered: 4,
+	})})
+
+	diff := Diff(prev, cur)
+	if len(diff.Changed) != 1 {
+		t.Fatalf("Changed: expected 1 socket, got %d", len(diff.Changed))
+	}
+	c := diff.Changed[0]
+	expected := TcpCounters{BytesAcked: 1000, SegsOut: 0x20, Delivered: 5}
+	if c.Reset || c.Delta != expected {
+		t.Fatalf("expected delta %+v without reset, got %+v (reset %v)", expected, c.Delta, c.Reset)
+	}
+}
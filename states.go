@@ -0,0 +1,108 @@
+package diag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SockState represents the state of a socket as reported in
+// DiagMsg.State and UnixDiagMsg.State.
+type SockState uint8
+
+// Based on the TCP states in include/net/tcp_states.h
+const (
+	StateEstablished SockState = iota + 1
+	StateSynSent
+	StateSynRecv
+	StateFinWait1
+	StateFinWait2
+	StateTimeWait
+	StateClose
+	StateCloseWait
+	StateLastAck
+	StateListen
+	StateClosing
+	StateNewSynRecv
+	StateBoundInactive
+)
+
+// AllStates selects all socket states in NetOption.State and UnixOption.State.
+const AllStates = ^uint32(0)
+
+var sockStateNames = map[SockState]string{
+	StateEstablished:   "ESTAB",
+	StateSynSent:       "SYN-SENT",
+	StateSynRecv:       "SYN-RECV",
+	StateFinWait1:      "FIN-WAIT-1",
+	StateFinWait2:      "FIN-WAIT-2",
+	StateTimeWait:      "TIME-WAIT",
+	StateClose:         "UNCONN",
+	StateCloseWait:     "CLOSE-WAIT",
+	StateLastAck:       "LAST-ACK",
+	StateListen:        "LISTEN",
+	StateClosing:       "CLOSING",
+	StateNewSynRecv:    "NEW-SYN-RECV",
+	StateBoundInactive: "BOUND-INACTIVE",
+}
+
+// String returns the name of the state as used by ss.
+func (s SockState) String() string {
+	if name, ok := sockStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SockState(%d)", uint8(s))
+}
+
+// StateMask returns the bit mask for NetOption.State and UnixOption.State
+// that selects states.
+func StateMask(states ...SockState) uint32 {
+	var mask uint32
+	for _, s := range states {
+		mask |= 1 << s
+	}
+	return mask
+}
+
+// SockState returns the state of the socket.
+func (m *DiagMsg) SockState() SockState {
+	return SockState(m.State)
+}
+
+// SockState returns the state of the socket.
+func (m *UnixDiagMsg) SockState() SockState {
+	return SockState(m.State)
+}
+
+var stateBucket = StateMask(StateSynRecv, StateTimeWait)
+
+// stateNames maps the state names and groups of ss to state masks.
+var stateNames = map[string]uint32{
+	"all":          AllStates,
+	"connected":    AllStates &^ StateMask(StateListen, StateClose),
+	"synchronized": AllStates &^ StateMask(StateListen, StateClose, StateSynSent),
+	"bucket":       stateBucket,
+	"big":          AllStates &^ stateBucket,
+	"established":  StateMask(StateEstablished),
+	"syn-sent":     StateMask(StateSynSent),
+	"syn-recv":     StateMask(StateSynRecv),
+	"fin-wait-1":   StateMask(StateFinWait1),
+	"fin-wait-2":   StateMask(StateFinWait2),
+	"time-wait":    StateMask(StateTimeWait),
+	"closed":       StateMask(StateClose),
+	"unconnected":  StateMask(StateClose),
+	"close-wait":   StateMask(StateCloseWait),
+	"last-ack":     StateMask(StateLastAck),
+	"listening":    StateMask(StateListen),
+	"closing":      StateMask(StateClosing),
+}
+
+// ParseState returns the state mask for a state name or state group as
+// used by ss, like established, time-wait, connected or bucket. Names
+// are case-insensitive.
+func ParseState(name string) (uint32, error) {
+	mask, ok := stateNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown state %q", name)
+	}
+	return mask, nil
+}
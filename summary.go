@@ -0,0 +1,165 @@
+package diag
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// Summary holds aggregated socket statistics like ss -s. Sockets are added
+// one at a time and a Summary only keeps the counters, not the sockets.
+// To track the top remote addresses, it keeps one counter per distinct
+// remote address, so its size grows with the number of remote addresses.
+type Summary struct {
+	// Total is the number of sockets.
+	Total int
+
+	// ByProtocol and ByFamily count the sockets by protocol, like tcp,
+	// udp or unix, and by family, like inet, inet6 or unix.
+	ByProtocol map[string]int
+	ByFamily   map[string]int
+
+	// ByState counts the sockets of each protocol by state.
+	ByState map[string]map[SockState]int
+
+	// Orphaned is the number of TCP sockets that are no longer attached
+	// to a file descriptor and TimeWait the number of TCP sockets in
+	// TIME_WAIT.
+	Orphaned int
+	TimeWait int
+
+	// Memory is the memory in bytes allocated by TCP and UDP sockets,
+	// as reported by SkMemInfo or MemInfo.
+	Memory uint64
+
+	topN    int
+	remotes map[netip.Addr]int
+}
+
+// RemoteCount is the number of connections to a remote address.
+type RemoteCount struct {
+	Addr  netip.Addr
+	Count int
+}
+
+// NewSummary returns an empty Summary that tracks the topN remote addresses
+// with the most connections. A topN of 0 disables the tracking of remote
+// addresses.
+func NewSummary(topN int) *Summary {
+	return &Summary{
+		ByProtocol: make(map[string]int),
+		ByFamily:   make(map[string]int),
+		ByState:    make(map[string]map[SockState]int),
+		topN:       topN,
+		remotes:    make(map[netip.Addr]int),
+	}
+}
+
+func (s *Summary) add(protocol string, family uint8, state SockState) {
+	s.Total++
+	s.ByProtocol[protocol]++
+	s.ByFamily[familyName(family)]++
+	if s.ByState[protocol] == nil {
+		s.ByState[protocol] = make(map[SockState]int)
+	}
+	s.ByState[protocol][state]++
+}
+
+// AddNet adds a network socket of the given protocol, like IPPROTO_TCP,
+// to s. The protocol is taken from obj, if reported by the kernel.
+func (s *Summary) AddNet(protocol uint8, obj *NetObject) {
+	if obj.Protocol != nil {
+		protocol = *obj.Protocol
+	}
+	state := obj.SockState()
+	s.add(protocolName(protocol), obj.Family, state)
+
+	if protocol == unix.IPPROTO_TCP {
+		switch {
+		case state == StateTimeWait:
+			s.TimeWait++
+		case obj.INode == 0 && state != StateSynRecv:
+			s.Orphaned++
+		}
+	}
+
+	switch {
+	case obj.SkMemInfo != nil:
+		m := obj.SkMemInfo
+		s.Memory += uint64(m.RMemAlloc) + uint64(m.WMemQueued) + uint64(m.FwdAlloc) +
+			uint64(m.OptMem)
+	case obj.MemInfo != nil:
+		m := obj.MemInfo
+		s.Memory += uint64(m.RMem) + uint64(m.WMem) + uint64(m.FMem)
+	}
+
+	if s.topN > 0 && state != StateListen {
+		if remote := obj.ID.Remote(obj.Family).Addr(); remote.IsValid() && !remote.IsUnspecified() {
+			s.remotes[remote]++
+		}
+	}
+}
+
+// AddUnix adds a Unix socket to s.
+func (s *Summary) AddUnix(obj *UnixObject) {
+	s.add("unix", obj.Family, obj.SockState())
+}
+
+// TopRemotes returns up to topN remote addresses ordered by the number of
+// connections, excluding listening sockets.
+func (s *Summary) TopRemotes() []RemoteCount {
+	top := make([]RemoteCount, 0, len(s.remotes))
+	for addr, n := range s.remotes {
+		top = append(top, RemoteCount{Addr: addr, Count: n})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Addr.Less(top[j].Addr)
+	})
+	if len(top) > s.topN {
+		top = top[:s.topN]
+	}
+	return top
+}
+
+// Summary returns the statistics of all TCP, UDP and Unix sockets. The
+// sockets are decoded one at a time and no NetObject or UnixObject is kept.
+// The raw netlink messages of each dump are still received as a whole
+// before they are decoded.
+func (d *Diag) Summary(topN int) (*Summary, error) {
+	s := NewSummary(topN)
+	for _, protocol := range []uint8{unix.IPPROTO_TCP, unix.IPPROTO_UDP} {
+		for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+			opt := &NetOption{
+				Family:   family,
+				Protocol: protocol,
+				Ext:      ExtSkMemInfo,
+				State:    AllStates,
+			}
+			if err := d.NetDumpFunc(opt, func(obj *NetObject) error {
+				s.AddNet(protocol, obj)
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	msgs, err := d.dumpQuery(UnixDiagReq{Family: unix.AF_UNIX, States: AllStates}, nil)
+	if err != nil {
+		return nil, err
+	}
+	opts := d.decode
+	for i, msg := range msgs {
+		var obj UnixObject
+		opts.index = i
+		if err := decodeUnixMessage(msg.Data, &obj, opts); err != nil {
+			return nil, withIndex(err, i)
+		}
+		s.AddUnix(&obj)
+	}
+	return s, nil
+}
@@ -0,0 +1,59 @@
+package diag
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestSummary(t *testing.T) {
+	s := NewSummary(2)
+	for _, obj := range []struct {
+		local, remote string
+		state         SockState
+		inode         uint32
+	}{
+		{"0.0.0.0:22", "0.0.0.0:0", StateListen, 1},
+		{"10.0.0.1:22", "192.0.2.1:50000", StateEstablished, 2},
+		{"10.0.0.1:22", "192.0.2.1:50001", StateEstablished, 3},
+		{"10.0.0.1:22", "192.0.2.2:50000", StateTimeWait, 0},
+		{"10.0.0.1:22", "192.0.2.3:50000", StateFinWait1, 0},
+		{"[2001:db8::1]:443", "[2001:db8::2]:50000", StateEstablished, 4},
+	} {
+		family := uint8(unix.AF_INET)
+		if netip.MustParseAddrPort(obj.local).Addr().Is6() {
+			family = unix.AF_INET6
+		}
+		sock := testSocket(family, obj.local, obj.remote, obj.state)
+		sock.INode = obj.inode
+		sock.SkMemInfo = &SkMemInfo{RMemAlloc: 100, WMemQueued: 10}
+		s.AddNet(unix.IPPROTO_TCP, &sock)
+	}
+	s.AddUnix(&UnixObject{UnixDiagMsg: UnixDiagMsg{Family: unix.AF_UNIX, State: uint8(StateListen)}})
+
+	if s.Total != 7 || s.ByProtocol["tcp"] != 6 || s.ByProtocol["unix"] != 1 {
+		t.Errorf("unexpected counts: %d %v", s.Total, s.ByProtocol)
+	}
+	if s.ByFamily["inet"] != 5 || s.ByFamily["inet6"] != 1 || s.ByFamily["unix"] != 1 {
+		t.Errorf("unexpected families: %v", s.ByFamily)
+	}
+	if s.ByState["tcp"][StateEstablished] != 3 || s.ByState["unix"][StateListen] != 1 {
+		t.Errorf("unexpected states: %v", s.ByState)
+	}
+	if s.Orphaned != 1 || s.TimeWait != 1 {
+		t.Errorf("Orphaned, TimeWait: expected 1, 1, got %d, %d", s.Orphaned, s.TimeWait)
+	}
+	if s.Memory != 660 {
+		t.Errorf("Memory: expected 660, got %d", s.Memory)
+	}
+
+	top := s.TopRemotes()
+	expected := []RemoteCount{
+		{netip.MustParseAddr("192.0.2.1"), 2},
+		{netip.MustParseAddr("192.0.2.2"), 1},
+	}
+	if len(top) != len(expected) || top[0] != expected[0] || top[1] != expected[1] {
+		t.Errorf("TopRemotes: expected %v, got %v", expected, top)
+	}
+}
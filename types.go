@@ -3,6 +3,11 @@ package diag
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"os/user"
+	"strconv"
+	"time"
 )
 
 // Config contains options for NETLINK_SOCK_DIAG
@@ -10,10 +15,134 @@ type Config struct {
 	// NetNS defines the network namespace
 	NetNS int
 
+	// ExtendedAcknowledge enables NETLINK_EXT_ACK, so errors of the
+	// kernel contain a message and the offset of the offending
+	// attribute. See NetlinkError.
+	ExtendedAcknowledge bool
+
+	// StrictCheck enables NETLINK_GET_STRICT_CHK, so the kernel
+	// rejects malformed requests instead of ignoring them.
+	StrictCheck bool
+
 	// SkipOptional allows to skip decoding of
 	// optional values likes NetAttribute and
 	// UnixAttribute.
 	SkipOptional bool
+
+	// NetAttributes selects the attributes that are decoded into
+	// NetAttribute. If zero, all attributes are decoded.
+	NetAttributes NetAttrMask
+
+	// UnixAttributes selects the attributes that are decoded into
+	// UnixAttribute. If zero, all attributes are decoded.
+	UnixAttributes UnixAttrMask
+
+	// Lenient allows to decode responses with attributes that are
+	// not known to this package. Such attributes are kept in
+	// NetAttribute.Unknown and UnixAttribute.Unknown and are
+	// reported to OnWarning instead of failing the dump.
+	Lenient bool
+
+	// OnWarning is called for every problem that is ignored in
+	// Lenient mode.
+	OnWarning func(err error)
+
+	// Record receives the netlink messages exchanged with the kernel,
+	// so they can be replayed with OpenReplay. ForEachNetNS records
+	// all namespaces into one capture.
+	Record io.Writer
+
+	// capture is shared by the connections of ForEachNetNS, which
+	// record to the same writer.
+	capture *captureWriter
+	// captureNetNS is the inode of the namespace that is recorded.
+	captureNetNS uint64
+}
+
+// NetAttrMask selects elements of NetAttribute.
+type NetAttrMask uint32
+
+// Selectors for elements of NetAttribute.
+const (
+	NetAttrMemInfo   NetAttrMask = 1 << inetDiagMemInfo
+	NetAttrInfo      NetAttrMask = 1 << inetDiagInfo
+	NetAttrVegasInfo NetAttrMask = 1 << inetDiagVegasInfo
+	NetAttrCong      NetAttrMask = 1 << inetDiagCong
+	NetAttrTOS       NetAttrMask = 1 << inetDiagTOS
+	NetAttrTClass    NetAttrMask = 1 << inetDiagTClass
+	NetAttrSkMemInfo NetAttrMask = 1 << inetDiagSKMemInfo
+	NetAttrShutdown  NetAttrMask = 1 << inetDiagShutdown
+	NetAttrDCTCPInfo NetAttrMask = 1 << inetDiagDCTCPInfo
+	NetAttrProtocol  NetAttrMask = 1 << inetDiagProtocol
+	NetAttrSKV6Only  NetAttrMask = 1 << inetDiagSKV6Only
+	NetAttrMark      NetAttrMask = 1 << inetDiagMark
+	NetAttrBBRInfo   NetAttrMask = 1 << inetDiagBBRInfo
+	NetAttrClassID   NetAttrMask = 1 << inetDiagClassID
+	NetAttrCGroupID  NetAttrMask = 1 << inetDiagCGroupID
+	NetAttrSockOpt   NetAttrMask = 1 << inetDiagSockOpt
+)
+
+func (m NetAttrMask) has(attrType uint16) bool {
+	return m == 0 || m&(1<<attrType) != 0
+}
+
+// UnixAttrMask selects elements of UnixAttribute.
+type UnixAttrMask uint32
+
+// Selectors for elements of UnixAttribute.
+const (
+	UnixAttrName     UnixAttrMask = 1 << unixDiagName
+	UnixAttrVfs      UnixAttrMask = 1 << unixDiagVFS
+	UnixAttrPeer     UnixAttrMask = 1 << unixDiagPeer
+	UnixAttrIcons    UnixAttrMask = 1 << unixDiagIcons
+	UnixAttrRQLen    UnixAttrMask = 1 << unixDiagRQLen
+	UnixAttrMemInfo  UnixAttrMask = 1 << unixDiagMemInfo
+	UnixAttrShutdown UnixAttrMask = 1 << unixDiagShutdown
+	UnixAttrUID      UnixAttrMask = 1 << unixDiagUID
+)
+
+func (m UnixAttrMask) has(attrType uint16) bool {
+	return m == 0 || m&(1<<attrType) != 0
+}
+
+// decodeOptions controls how responses are decoded.
+type decodeOptions struct {
+	skipOptional bool
+	netAttrs     NetAttrMask
+	unixAttrs    UnixAttrMask
+	lenient      bool
+	onWarning    func(err error)
+
+	// index is the position of the decoded message within the dump.
+	index int
+}
+
+func (c *Config) decodeOptions() decodeOptions {
+	return decodeOptions{
+		skipOptional: c.SkipOptional,
+		netAttrs:     c.NetAttributes,
+		unixAttrs:    c.UnixAttributes,
+		lenient:      c.Lenient,
+		onWarning:    c.OnWarning,
+	}
+}
+
+// unknown returns err unless decoding is lenient. In lenient mode
+// err is reported as warning.
+func (o decodeOptions) unknown(err error) error {
+	if !o.lenient {
+		return err
+	}
+	if o.onWarning != nil {
+		o.onWarning(withIndex(err, o.index))
+	}
+	return nil
+}
+
+// RawAttribute is an attribute that is not decoded by this package.
+type RawAttribute struct {
+	Type uint16 `json:"type"`
+	Data []byte `json:"data"`
 }
 
 const (
@@ -42,6 +171,29 @@ const (
 	inetDiagSockOpt
 )
 
+// Extensions that can be requested with NetOption.Ext.
+const (
+	ExtMemInfo   = 1 << (inetDiagMemInfo - 1)
+	ExtInfo      = 1 << (inetDiagInfo - 1)
+	ExtVegasInfo = 1 << (inetDiagVegasInfo - 1)
+	ExtCong      = 1 << (inetDiagCong - 1)
+	ExtTOS       = 1 << (inetDiagTOS - 1)
+	ExtTClass    = 1 << (inetDiagTClass - 1)
+	ExtSkMemInfo = 1 << (inetDiagSKMemInfo - 1)
+	ExtShutdown  = 1 << (inetDiagShutdown - 1)
+)
+
+// Flags that can be requested with UnixOption.Show.
+const (
+	ShowName = 1 << iota
+	ShowVfs
+	ShowPeer
+	ShowIcons
+	ShowRQLen
+	ShowMemInfo
+	ShowUID
+)
+
 var nativeEndian = binary.NativeEndian
 
 // Based on inet_diag_req_v2
@@ -69,8 +221,8 @@ type UnixDiagReq struct {
 type SockID struct {
 	SPort  uint16    // in network byte order, use Ntohs() for host byte order
 	DPort  uint16    // in network byte order, use Ntohs() for host byte order
-	Src    [4]uint32 // use ToNetipAddr() for netip.Addr representation
-	Dst    [4]uint32 // use ToNetipAddr() for netip.Addr representation
+	Src    [4]uint32 // use Local() for netip.AddrPort representation
+	Dst    [4]uint32 // use Remote() for netip.AddrPort representation
 	If     uint32
 	Cookie [2]uint32
 }
@@ -81,11 +233,6 @@ func marshalStruct(s interface{}) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
-func unmarshalStruct(data []byte, s interface{}) error {
-	b := bytes.NewReader(data)
-	return binary.Read(b, nativeEndian, s)
-}
-
 // Based on inet_diag_msg
 type DiagMsg struct {
 	Family  uint8
@@ -100,6 +247,82 @@ type DiagMsg struct {
 	INode   uint32
 }
 
+// TimerKind represents the kind of timer that is pending on a socket.
+type TimerKind uint8
+
+// Values of DiagMsg.Timer as set by inet_diag_msg_common_fill in the kernel.
+const (
+	TimerOff TimerKind = iota
+	TimerOn
+	TimerKeepalive
+	TimerTimeWait
+	TimerProbe
+)
+
+func (t TimerKind) String() string {
+	switch t {
+	case TimerOff:
+		return "off"
+	case TimerOn:
+		return "on"
+	case TimerKeepalive:
+		return "keepalive"
+	case TimerTimeWait:
+		return "timewait"
+	case TimerProbe:
+		return "persist"
+	}
+	return fmt.Sprintf("TimerKind(%d)", uint8(t))
+}
+
+// TimerKind returns the kind of timer that is pending on the socket.
+func (m *DiagMsg) TimerKind() TimerKind {
+	return TimerKind(m.Timer)
+}
+
+// ExpiresDuration returns the time until the pending timer expires.
+func (m *DiagMsg) ExpiresDuration() time.Duration {
+	return time.Duration(m.Expires) * time.Millisecond
+}
+
+// User looks up the owner of the socket.
+func (m *DiagMsg) User() (*user.User, error) {
+	return user.LookupId(strconv.FormatUint(uint64(m.UID), 10))
+}
+
+// ShutdownMode represents the shutdown state of a socket.
+type ShutdownMode uint8
+
+// Based on RCV_SHUTDOWN and SEND_SHUTDOWN in include/net/sock.h
+const (
+	ShutdownRcv ShutdownMode = 1 << iota
+	ShutdownSend
+)
+
+// Rcv reports whether the receive direction is shut down.
+func (s ShutdownMode) Rcv() bool {
+	return s&ShutdownRcv != 0
+}
+
+// Send reports whether the send direction is shut down.
+func (s ShutdownMode) Send() bool {
+	return s&ShutdownSend != 0
+}
+
+func (s ShutdownMode) String() string {
+	switch s {
+	case 0:
+		return "none"
+	case ShutdownRcv:
+		return "rcv"
+	case ShutdownSend:
+		return "send"
+	case ShutdownRcv | ShutdownSend:
+		return "rcv|send"
+	}
+	return fmt.Sprintf("ShutdownMode(%d)", uint8(s))
+}
+
 // Based on unix_diag_msg
 type UnixDiagMsg struct {
 	Family uint8
@@ -112,25 +335,34 @@ type UnixDiagMsg struct {
 
 // Based on unix_diag_vfs
 type UnixDiagVfs struct {
-	Ino uint32
-	Dev uint32
+	Ino uint32 `json:"ino"`
+	Dev uint32 `json:"dev"`
 }
 
 // Based on unix_diag_rqlen
 type UnixDiagRqLen struct {
-	RQueue uint32
-	WQueue uint32
+	RQueue uint32 `json:"r_queue"`
+	WQueue uint32 `json:"w_queue"`
 }
 
 // NetObject represents a network response
 type NetObject struct {
 	DiagMsg
 	NetAttribute
+
+	// Processes holding the socket. Set by ProcResolver.
+	Processes []Process
+
+	// CGroup of the socket. Set by CGroupResolver.
+	CGroup *CGroup
 }
 
 type UnixObject struct {
 	UnixDiagMsg
 	UnixAttribute
+
+	// Processes holding the socket. Set by ProcResolver.
+	Processes []Process
 }
 
 // NetAttribute contains various elements
@@ -152,6 +384,21 @@ type NetAttribute struct {
 	SockOpt   *SockOpt
 	TcpInfo   *TcpInfo
 	SctpInfo  *SctpInfo
+
+	// InfoLen is the length of INET_DIAG_INFO as reported by the kernel.
+	// Use TcpInfoHas() to check whether a field of TcpInfo was reported.
+	InfoLen int
+
+	// Unknown holds attributes that could not be decoded in lenient mode.
+	Unknown []RawAttribute
+}
+
+// ShutdownMode returns the shutdown state of the socket, if reported.
+func (a *NetAttribute) ShutdownMode() (ShutdownMode, bool) {
+	if a.Shutdown == nil {
+		return 0, false
+	}
+	return ShutdownMode(*a.Shutdown), true
 }
 
 // UnixAttribute contains various elements
@@ -164,6 +411,25 @@ type UnixAttribute struct {
 	UID      *uint32
 	Peer     *uint32
 	Icons    []uint32
+
+	// Unknown holds attributes that could not be decoded in lenient mode.
+	Unknown []RawAttribute
+}
+
+// ShutdownMode returns the shutdown state of the socket, if reported.
+func (a *UnixAttribute) ShutdownMode() (ShutdownMode, bool) {
+	if a.Shutdown == nil {
+		return 0, false
+	}
+	return ShutdownMode(*a.Shutdown), true
+}
+
+// User looks up the owner of the socket, if reported.
+func (a *UnixAttribute) User() (*user.User, error) {
+	if a.UID == nil {
+		return nil, fmt.Errorf("no UID reported for socket")
+	}
+	return user.LookupId(strconv.FormatUint(uint64(*a.UID), 10))
 }
 
 // Based on inet_diag_sockopt
@@ -187,58 +453,91 @@ type SockOpt struct {
 	Bitfield2 uint8
 }
 
+// RecvErr reports whether IP_RECVERR is set.
+func (s *SockOpt) RecvErr() bool { return s.Bitfield1&(1<<0) != 0 }
+
+// IsIcsk reports whether the socket is a connection oriented socket.
+func (s *SockOpt) IsIcsk() bool { return s.Bitfield1&(1<<1) != 0 }
+
+// Freebind reports whether IP_FREEBIND is set.
+func (s *SockOpt) Freebind() bool { return s.Bitfield1&(1<<2) != 0 }
+
+// Hdrincl reports whether IP_HDRINCL is set.
+func (s *SockOpt) Hdrincl() bool { return s.Bitfield1&(1<<3) != 0 }
+
+// McLoop reports whether IP_MULTICAST_LOOP is set.
+func (s *SockOpt) McLoop() bool { return s.Bitfield1&(1<<4) != 0 }
+
+// Transparent reports whether IP_TRANSPARENT is set.
+func (s *SockOpt) Transparent() bool { return s.Bitfield1&(1<<5) != 0 }
+
+// McAll reports whether IP_MULTICAST_ALL is set.
+func (s *SockOpt) McAll() bool { return s.Bitfield1&(1<<6) != 0 }
+
+// Nodefrag reports whether IP_NODEFRAG is set.
+func (s *SockOpt) Nodefrag() bool { return s.Bitfield1&(1<<7) != 0 }
+
+// BindAddressNoPort reports whether IP_BIND_ADDRESS_NO_PORT is set.
+func (s *SockOpt) BindAddressNoPort() bool { return s.Bitfield2&(1<<0) != 0 }
+
+// RecvErrRFC4884 reports whether IP_RECVERR_RFC4884 is set.
+func (s *SockOpt) RecvErrRFC4884() bool { return s.Bitfield2&(1<<1) != 0 }
+
+// DeferConnect reports whether TCP_FASTOPEN_CONNECT deferred the connect.
+func (s *SockOpt) DeferConnect() bool { return s.Bitfield2&(1<<2) != 0 }
+
 // Based on inet_diag_meminfo
 type MemInfo struct {
-	RMem uint32
-	WMem uint32
-	FMem uint32
-	TMem uint32
+	RMem uint32 `json:"rmem"`
+	WMem uint32 `json:"wmem"`
+	FMem uint32 `json:"fmem"`
+	TMem uint32 `json:"tmem"`
 }
 
 // Based on sock_diag(7)
 type SkMemInfo struct {
 	// The amount of data in receive queue.
-	RMemAlloc uint32
+	RMemAlloc uint32 `json:"rmem_alloc"`
 	// The receive socket buffer as set by SO_RCVBUF.
-	RcvBuff uint32
+	RcvBuff uint32 `json:"rcvbuf"`
 	// The amount of data in send queue.
-	WMemAlloc uint32
+	WMemAlloc uint32 `json:"wmem_alloc"`
 	// The send socket buffer as set by SO_SNDBUF.
-	SndBuff uint32
+	SndBuff uint32 `json:"sndbuf"`
 	// The amount of memory scheduled for future use (TCP only).
-	FwdAlloc uint32
+	FwdAlloc uint32 `json:"fwd_alloc"`
 	// The amount of data queued by TCP, but not yet sent.
-	WMemQueued uint32
+	WMemQueued uint32 `json:"wmem_queued"`
 	// The amount of memory allocated for the socket's service needs (e.g., socket filter).
-	OptMem uint32
+	OptMem uint32 `json:"optmem"`
 	// The amount of packets in the backlog (not yet processed).
-	Backlog uint32
+	Backlog uint32 `json:"backlog"`
 	// Check https://manpages.debian.org/stretch/manpages/sock_diag.7.en.html
-	Drops uint32
+	Drops uint32 `json:"drops"`
 }
 
 // Based on tcp_bbr_info
 type BBRInfo struct {
-	BwLo       uint32
-	BwHi       uint32
-	MinRTT     uint32
-	PacingGain uint32
-	CwndGaing  uint32
+	BwLo       uint32 `json:"bw_lo"`
+	BwHi       uint32 `json:"bw_hi"`
+	MinRTT     uint32 `json:"min_rtt_us"`
+	PacingGain uint32 `json:"pacing_gain"`
+	CwndGaing  uint32 `json:"cwnd_gain"`
 }
 
 // Based on tcpvegas_info
 type VegasInfo struct {
-	Enabled uint32
-	RttCnt  uint32
-	Rtt     uint32
-	MinRtt  uint32
+	Enabled uint32 `json:"enabled"`
+	RttCnt  uint32 `json:"rtt_cnt"`
+	Rtt     uint32 `json:"rtt_us"`
+	MinRtt  uint32 `json:"min_rtt_us"`
 }
 
 // Based on tcp_dctcp_info
 type DCTCPInfo struct {
-	Enabeld uint16
-	CeState uint16
-	Alpha   uint32
-	AbECN   uint32
-	AbTot   uint32
+	Enabeld uint16 `json:"enabled"`
+	CeState uint16 `json:"ce_state"`
+	Alpha   uint32 `json:"alpha"`
+	AbECN   uint32 `json:"ab_ecn"`
+	AbTot   uint32 `json:"ab_tot"`
 }
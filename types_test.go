@@ -0,0 +1,61 @@
+package diag
+
+import "testing"
+
+func TestSockOpt(t *testing.T) {
+	so := SockOpt{
+		Bitfield1: 0x24, // freebind, transparent
+		Bitfield2: 0x05, // bind_address_no_port, defer_connect
+	}
+
+	for name, test := range map[string]struct {
+		got      bool
+		expected bool
+	}{
+		"RecvErr":           {so.RecvErr(), false},
+		"IsIcsk":            {so.IsIcsk(), false},
+		"Freebind":          {so.Freebind(), true},
+		"Hdrincl":           {so.Hdrincl(), false},
+		"McLoop":            {so.McLoop(), false},
+		"Transparent":       {so.Transparent(), true},
+		"McAll":             {so.McAll(), false},
+		"Nodefrag":          {so.Nodefrag(), false},
+		"BindAddressNoPort": {so.BindAddressNoPort(), true},
+		"RecvErrRFC4884":    {so.RecvErrRFC4884(), false},
+		"DeferConnect":      {so.DeferConnect(), true},
+	} {
+		if test.got != test.expected {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, test.got)
+		}
+	}
+}
+
+func TestDiagMsgTimer(t *testing.T) {
+	msg := DiagMsg{
+		Timer:   2,
+		Expires: 7200000,
+	}
+
+	if got := msg.TimerKind(); got != TimerKeepalive || got.String() != "keepalive" {
+		t.Fatalf("TimerKind: expected keepalive, got %v", got)
+	}
+	if got := msg.ExpiresDuration().String(); got != "2h0m0s" {
+		t.Fatalf("ExpiresDuration: expected 2h0m0s, got %s", got)
+	}
+}
+
+func TestShutdownMode(t *testing.T) {
+	shutdown := uint8(3)
+	attr := NetAttribute{Shutdown: &shutdown}
+
+	mode, ok := attr.ShutdownMode()
+	if !ok {
+		t.Fatalf("expected shutdown mode to be reported")
+	}
+	if !mode.Rcv() || !mode.Send() || mode.String() != "rcv|send" {
+		t.Fatalf("unexpected shutdown mode %v", mode)
+	}
+	if _, ok := (&UnixAttribute{}).ShutdownMode(); ok {
+		t.Fatalf("expected no shutdown mode without attribute")
+	}
+}
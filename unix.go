@@ -1,12 +1,11 @@
 package diag
 
 import (
-	"encoding/binary"
+	"bytes"
 	"errors"
 	"fmt"
 
 	"github.com/florianl/go-diag/internal/unix"
-	"github.com/mdlayher/netlink"
 )
 
 const (
@@ -20,50 +19,57 @@ const (
 	unixDiagUID
 )
 
-func extractUnixAttributes(data []byte, info *UnixAttribute) error {
-	ad, err := netlink.NewAttributeDecoder(data)
-	if err != nil {
-		return err
-	}
+func extractUnixAttributes(data []byte, info *UnixAttribute, opts decodeOptions) error {
+	ad := attrDecoder{b: data}
 	var multiError error
-	for ad.Next() {
-		switch adType := ad.Type(); adType {
+	for ad.next() {
+		adType := ad.typ()
+		if !opts.unixAttrs.has(adType) {
+			continue
+		}
+		switch adType {
 		case unixDiagName:
-			info.Name = stringPtr(ad.String())
+			info.Name = stringPtr(string(ad.string()))
 		case unixDiagVFS:
 			vfs := &UnixDiagVfs{}
-			err := unmarshalStruct(ad.Bytes(), vfs)
-			multiError = errors.Join(multiError, err)
+			err := vfs.decode(ad.bytes())
+			multiError = errors.Join(multiError, decodeError(int(adType), ad.bytes(), err))
 			info.Vfs = vfs
 		case unixDiagPeer:
-			info.Peer = uint32Ptr(ad.Uint32())
+			info.Peer = uint32Ptr(ad.uint32())
 		case unixDiagIcons:
-			tmp := ad.Bytes()
+			tmp := ad.bytes()
 			numIcons := len(tmp) / 4
 			icons := make([]uint32, 0, numIcons)
 			for i := 0; i < numIcons; i++ {
-				icons = append(icons, binary.LittleEndian.Uint32(tmp[i*4:(i+1)*4]))
+				icons = append(icons, nativeEndian.Uint32(tmp[i*4:(i+1)*4]))
 			}
 			info.Icons = icons
 		case unixDiagRQLen:
 			rqlen := &UnixDiagRqLen{}
-			err := unmarshalStruct(ad.Bytes(), rqlen)
-			multiError = errors.Join(multiError, err)
+			err := rqlen.decode(ad.bytes())
+			multiError = errors.Join(multiError, decodeError(int(adType), ad.bytes(), err))
 			info.RQLen = rqlen
 		case unixDiagMemInfo:
 			mi := &MemInfo{}
-			err := unmarshalStruct(ad.Bytes(), mi)
-			multiError = errors.Join(multiError, err)
+			err := mi.decode(ad.bytes())
+			multiError = errors.Join(multiError, decodeError(int(adType), ad.bytes(), err))
 			info.MemInfo = mi
 		case unixDiagShutdown:
-			info.Shutdown = uint8Ptr(ad.Uint8())
+			info.Shutdown = uint8Ptr(ad.uint8())
 		case unixDiagUID:
-			info.UID = uint32Ptr(ad.Uint32())
+			info.UID = uint32Ptr(ad.uint32())
 		default:
-			multiError = errors.Join(multiError, fmt.Errorf("unix type %d not implemented", adType))
+			err := opts.unknown(decodeError(int(adType), ad.bytes(),
+				fmt.Errorf("unix type %d not implemented", adType)))
+			multiError = errors.Join(multiError, err)
+			info.Unknown = append(info.Unknown, RawAttribute{
+				Type: adType,
+				Data: bytes.Clone(ad.bytes()),
+			})
 		}
 	}
-	return errors.Join(multiError, ad.Err())
+	return errors.Join(multiError, decodeError(-1, data, ad.err))
 }
 
 // UnixOption defines a query to Unix sockets.
@@ -82,11 +88,11 @@ func (d *Diag) UnixDump(opt *UnixOption) ([]UnixObject, error) {
 		States:   opt.State,
 		Show:     opt.Show,
 	}
-	respMsgs, err := d.dumpQuery(header)
+	respMsgs, err := d.dumpQuery(header, nil)
 	if err != nil {
 		return nil, err
 	}
-	objs, err := handleUnixResponse(respMsgs, d.skipOptional)
+	objs, err := handleUnixResponse(respMsgs, d.decode)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,217 @@
+package diag
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+// Events reported by a Watcher.
+const (
+	// EventNew reports a socket that was not part of the previous poll.
+	EventNew EventType = iota
+	// EventClosed reports a socket that disappeared since the previous poll.
+	EventClosed
+	// EventStateChange reports a socket whose state changed.
+	EventStateChange
+	// EventRetransmitSpike reports a socket that retransmitted at least
+	// WatchConfig.RetransmitThreshold segments since the previous poll.
+	EventRetransmitSpike
+	// EventQueueBuildup reports a socket whose receive or send queue
+	// exceeded WatchConfig.QueueThreshold.
+	EventQueueBuildup
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNew:
+		return "new"
+	case EventClosed:
+		return "closed"
+	case EventStateChange:
+		return "state-change"
+	case EventRetransmitSpike:
+		return "retransmit-spike"
+	case EventQueueBuildup:
+		return "queue-buildup"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a change of a socket observed by a Watcher.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Socket is the current socket or, for EventClosed, the socket as
+	// it was last seen.
+	Socket NetObject
+	// Prev is the socket of the previous poll. It is nil for EventNew
+	// and EventClosed.
+	Prev *NetObject
+	// Delta holds the growth of the TcpInfo counters since the previous
+	// poll.
+	Delta TcpCounters
+}
+
+// WatchConfig contains options for a Watcher.
+type WatchConfig struct {
+	// Interval between two polls. It defaults to one second.
+	Interval time.Duration
+
+	// Jitter adds a random delay between zero and Jitter to every
+	// interval, so multiple watchers do not poll in lockstep.
+	Jitter time.Duration
+
+	// Dump returns the sockets to watch. It defaults to all TCP sockets
+	// of AF_INET and AF_INET6 including TcpInfo.
+	Dump func() ([]NetObject, error)
+
+	// ReportExisting reports the sockets of the first poll as EventNew.
+	// Otherwise the first poll only records the sockets.
+	ReportExisting bool
+
+	// RetransmitThreshold is the number of retransmitted segments between
+	// two polls that triggers EventRetransmitSpike. Zero disables the event.
+	RetransmitThreshold uint64
+
+	// QueueThreshold is the size of the receive or send queue above which
+	// EventQueueBuildup is triggered. The event is reported once, when the
+	// queue exceeds the threshold. Zero disables the event.
+	QueueThreshold uint32
+}
+
+// Watcher polls sockets and reports changes between the polls.
+// A Watcher is not safe for concurrent use.
+type Watcher struct {
+	cfg  WatchConfig
+	prev *Snapshot
+}
+
+// NewWatcher returns a Watcher for the sockets of d.
+func NewWatcher(d *Diag, config *WatchConfig) *Watcher {
+	w := &Watcher{}
+	if config != nil {
+		w.cfg = *config
+	}
+	if w.cfg.Interval <= 0 {
+		w.cfg.Interval = time.Second
+	}
+	if w.cfg.Dump == nil {
+		w.cfg.Dump = func() ([]NetObject, error) {
+			return dumpTCPInfo(d)
+		}
+	}
+	return w
+}
+
+// dumpTCPInfo is like TCPDump, but includes TcpInfo.
+func dumpTCPInfo(d *Diag) ([]NetObject, error) {
+	var results []NetObject
+	opt := &NetOption{
+		Protocol: unix.IPPROTO_TCP,
+		Ext:      ExtInfo,
+		State:    AllStates,
+	}
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		opt.Family = family
+		objs, err := d.NetDump(opt)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, objs...)
+	}
+	return results, nil
+}
+
+// Poll dumps the sockets once and returns the events since the previous
+// call of Poll.
+func (w *Watcher) Poll() ([]Event, error) {
+	objs, err := w.cfg.Dump()
+	if err != nil {
+		return nil, err
+	}
+	cur := NewSnapshot(time.Now(), objs)
+	prev := w.prev
+	w.prev = cur
+	if prev == nil && !w.cfg.ReportExisting {
+		return nil, nil
+	}
+
+	diff := Diff(prev, cur)
+	var events []Event
+	for _, obj := range diff.Closed {
+		events = append(events, Event{Type: EventClosed, Time: cur.Time, Socket: obj})
+	}
+	for _, obj := range diff.Opened {
+		events = append(events, Event{Type: EventNew, Time: cur.Time, Socket: obj})
+		if w.queueExceeded(&obj) {
+			events = append(events, Event{Type: EventQueueBuildup, Time: cur.Time, Socket: obj})
+		}
+	}
+	for i := range diff.Changed {
+		c := &diff.Changed[i]
+		event := Event{Time: cur.Time, Socket: c.Cur, Prev: &c.Prev, Delta: c.Delta}
+		if c.StateChanged() {
+			event.Type = EventStateChange
+			events = append(events, event)
+		}
+		// After a reset, Delta holds the counters of the whole lifetime.
+		if w.cfg.RetransmitThreshold != 0 && !c.Reset &&
+			c.Delta.TotalRetrans >= w.cfg.RetransmitThreshold {
+			event.Type = EventRetransmitSpike
+			events = append(events, event)
+		}
+		if w.queueExceeded(&c.Cur) && !w.queueExceeded(&c.Prev) {
+			event.Type = EventQueueBuildup
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (w *Watcher) queueExceeded(obj *NetObject) bool {
+	limit := w.cfg.QueueThreshold
+	return limit != 0 && (obj.RQueue > limit || obj.WQueue > limit)
+}
+
+// Run polls until ctx is done and sends the events to events. It returns
+// the error of a failed poll or ctx.Err().
+func (w *Watcher) Run(ctx context.Context, events chan<- Event) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, err := w.Poll()
+		if err != nil {
+			return err
+		}
+		for _, event := range batch {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		next := w.cfg.Interval
+		if w.cfg.Jitter > 0 {
+			next += rand.N(w.cfg.Jitter)
+		}
+		timer.Reset(next)
+	}
+}
@@ -0,0 +1,122 @@
+package diag
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/florianl/go-diag/internal/unix"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	socket := func(cookie uint32, state SockState, retrans uint32, wqueue uint32) NetObject {
+		obj := testSocket(unix.AF_INET, "10.0.0.1:443", "192.0.2.1:50000", state)
+		obj.ID.Cookie[0] = cookie
+		obj.WQueue = wqueue
+		obj.TcpInfo = &TcpInfo{RotalRetrans: retrans}
+		return obj
+	}
+	polls := [][]NetObject{
+		{socket(1, StateSynSent, 0, 0), socket(2, StateEstablished, 0, 0)},
+		{socket(1, StateEstablished, 0, 0), socket(2, StateEstablished, 10, 5000), socket(3, StateEstablished, 0, 0)},
+		{socket(2, StateEstablished, 11, 6000), socket(3, StateEstablished, 0, 0)},
+	}
+	w := NewWatcher(nil, &WatchConfig{
+		Dump: func() ([]NetObject, error) {
+			objs := polls[0]
+			polls = polls[1:]
+			return objs, nil
+		},
+		RetransmitThreshold: 5,
+		QueueThreshold:      4096,
+	})
+
+	type result struct {
+		typ    EventType
+		cookie uint32
+	}
+	for i, expected := range [][]result{
+		nil,
+		{{EventNew, 3}, {EventStateChange, 1}, {EventRetransmitSpike, 2}, {EventQueueBuildup, 2}},
+		{{EventClosed, 1}},
+	} {
+		events, err := w.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []result
+		for _, e := range events {
+			got = append(got, result{e.Type, e.Socket.ID.Cookie[0]})
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("poll %d: expected %v, got %v", i, expected, got)
+		}
+		for j := range got {
+			if got[j] != expected[j] {
+				t.Errorf("poll %d: expected %v, got %v", i, expected, got)
+			}
+		}
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	errDump := errors.New("dump failed")
+	calls := 0
+	w := NewWatcher(nil, &WatchConfig{
+		Interval:       time.Millisecond,
+		Jitter:         time.Millisecond,
+		ReportExisting: true,
+		Dump: func() ([]NetObject, error) {
+			calls++
+			if calls > 2 {
+				return nil, errDump
+			}
+			return []NetObject{testSocket(unix.AF_INET, "10.0.0.1:22", "0.0.0.0:0", StateListen)}, nil
+		},
+	})
+
+	events := make(chan Event, 10)
+	if err := w.Run(context.Background(), events); !errors.Is(err, errDump) {
+		t.Fatalf("expected %v, got %v", errDump, err)
+	}
+	if len(events) != 1 || (<-events).Type != EventNew {
+		t.Fatalf("expected a single new socket")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Run(ctx, events); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestWatcherCounterWrap(t *testing.T) {
+	socket := func(segsOut, retrans uint32) NetObject {
+		obj := testSocket(unix.AF_INET, "10.0.0.1:443", "192.0.2.1:50000", StateEstablished)
+		obj.TcpInfo = &TcpInfo{BytesAcked: 1 << 40, SegsOut: segsOut, RotalRetrans: retrans}
+		return obj
+	}
+	polls := [][]NetObject{
+		{socket(0xfffffff0, 100)},
+		{socket(0x10, 101)},
+	}
+	w := NewWatcher(nil, &WatchConfig{
+		Dump: func() ([]NetObject, error) {
+			objs := polls[0]
+			polls = polls[1:]
+			return objs, nil
+		},
+		RetransmitThreshold: 5,
+	})
+
+	for i := 0; i < 2; i++ {
+		events, err := w.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 0 {
+			t.Fatalf("poll %d: expected no events, got %+v", i, events)
+		}
+	}
+}